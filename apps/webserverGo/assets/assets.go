@@ -0,0 +1,347 @@
+package assets
+
+import (
+	"bytes"
+	"container/list"
+	"embed"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/png"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	FontImpact          = "fonts/impact.ttf"
+	FontRoboto          = "fonts/Roboto-Regular.ttf"
+	FontLiberationSerif = "fonts/LiberationSerif-Regular.ttf"
+
+	FontGGSans           = "fonts/ggsans-Regular.ttf"
+	FontGGSansBold       = "fonts/ggsans-Bold.ttf"
+	FontGGSansItalic     = "fonts/ggsans-Italic.ttf"
+	FontGGSansBoldItalic = "fonts/ggsans-BoldItalic.ttf"
+	FontDejaVuSansMono   = "fonts/DejaVuSansMono.ttf"
+
+	FontDejaVuSans     = "fonts/DejaVuSans.ttf"
+	FontNotoSansArabic = "fonts/NotoSansArabic.ttf"
+	FontMPlus1p        = "fonts/mplus-1p-regular.ttf"
+	FontEmojiOne       = "fonts/EmojiOneColor.otf"
+	FontUnifont        = "fonts/unifont.otf"
+
+	ImageWantedPoster = "images/wanted_poster.png"
+	ImageJailBars     = "images/jail_bars.png"
+	ImageFrameGold    = "images/frame_gold.png"
+	ImageFrameRainbow = "images/frame_rainbow.png"
+)
+
+// Fonts and Images list every bundled asset, which Verify loads for the
+// readiness probe.
+var (
+	Fonts = []string{
+		FontImpact,
+		FontRoboto,
+		FontLiberationSerif,
+		FontGGSans,
+		FontGGSansBold,
+		FontGGSansItalic,
+		FontGGSansBoldItalic,
+		FontDejaVuSansMono,
+		FontDejaVuSans,
+		FontNotoSansArabic,
+		FontMPlus1p,
+		FontEmojiOne,
+		FontUnifont,
+	}
+	Images = []string{
+		ImageWantedPoster,
+		ImageJailBars,
+		ImageFrameGold,
+		ImageFrameRainbow,
+	}
+)
+
+//go:embed fonts images emoji
+var embedded embed.FS
+
+type faceKey struct {
+	name string
+	size float64
+}
+
+type cachedFace struct {
+	key  faceKey
+	face font.Face
+}
+
+const (
+	// Face sizes are rounded to whole pixels and clamped to this range, so
+	// sizes from requests map onto a bounded set of faces.
+	MinFaceSize = 1
+	MaxFaceSize = 512
+	// maxFaces is how many faces are cached. The least recently used face is
+	// dropped first; renders still holding it keep working.
+	maxFaces = 256
+)
+
+var (
+	mu          sync.RWMutex
+	overrideDir string
+	fonts       = make(map[string]*opentype.Font)
+	images      = make(map[string]image.Image)
+
+	facesMu  sync.Mutex
+	faces    = make(map[faceKey]*list.Element)
+	faceList = list.New()
+)
+
+// SetOverrideDir makes files under dir take precedence over the embedded ones,
+// e.g. dir/fonts/impact.ttf replaces FontImpact. Assets missing from dir still
+// fall back to the embedded copies. Previously parsed assets are discarded.
+func SetOverrideDir(dir string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	overrideDir = dir
+	fonts = make(map[string]*opentype.Font)
+	images = make(map[string]image.Image)
+
+	facesMu.Lock()
+	defer facesMu.Unlock()
+	faces = make(map[faceKey]*list.Element)
+	faceList.Init()
+}
+
+// ReadFile returns the raw bytes of an asset.
+func ReadFile(name string) ([]byte, error) {
+	mu.RLock()
+	dir := overrideDir
+	mu.RUnlock()
+
+	if dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err == nil {
+			return data, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return embedded.ReadFile(name)
+}
+
+// Font returns the parsed font, parsing it only on first use.
+func Font(name string) (*opentype.Font, error) {
+	mu.RLock()
+	f, ok := fonts[name]
+	mu.RUnlock()
+	if ok {
+		return f, nil
+	}
+
+	data, err := ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font %s: %w", name, err)
+	}
+	f, err = opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font %s: %w", name, err)
+	}
+
+	mu.Lock()
+	fonts[name] = f
+	mu.Unlock()
+	return f, nil
+}
+
+// FaceSize returns the size Face makes a face at when asked for size.
+func FaceSize(size float64) float64 {
+	return min(max(math.Round(size), MinFaceSize), MaxFaceSize)
+}
+
+// Face returns a face of the font at FaceSize(size). Recently used faces are
+// cached and are safe to share between concurrent renders.
+func Face(name string, size float64) (font.Face, error) {
+	size = FaceSize(size)
+	key := faceKey{name: name, size: size}
+	if face, ok := lookupFace(key); ok {
+		return face, nil
+	}
+
+	f, err := Font(name)
+	if err != nil {
+		return nil, err
+	}
+	otFace, err := opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create face for %s: %w", name, err)
+	}
+
+	facesMu.Lock()
+	defer facesMu.Unlock()
+	if el, ok := faces[key]; ok {
+		otFace.Close()
+		faceList.MoveToFront(el)
+		return el.Value.(*cachedFace).face, nil
+	}
+	face := &sharedFace{face: otFace}
+	faces[key] = faceList.PushFront(&cachedFace{key: key, face: face})
+	for faceList.Len() > maxFaces {
+		oldest := faceList.Back()
+		faceList.Remove(oldest)
+		delete(faces, oldest.Value.(*cachedFace).key)
+	}
+	return face, nil
+}
+
+func lookupFace(key faceKey) (font.Face, bool) {
+	facesMu.Lock()
+	defer facesMu.Unlock()
+	el, ok := faces[key]
+	if !ok {
+		return nil, false
+	}
+	faceList.MoveToFront(el)
+	return el.Value.(*cachedFace).face, true
+}
+
+// Image returns the decoded image, decoding it only on first use. Callers must
+// treat the result as read-only.
+func Image(name string) (image.Image, error) {
+	mu.RLock()
+	img, ok := images[name]
+	mu.RUnlock()
+	if ok {
+		return img, nil
+	}
+
+	data, err := ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image %s: %w", name, err)
+	}
+	img, _, err = image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image %s: %w", name, err)
+	}
+
+	mu.Lock()
+	images[name] = img
+	mu.Unlock()
+	return img, nil
+}
+
+// sharedFace serialises access to an opentype face. The opentype rasterizer
+// reuses its mask buffer between Glyph calls, so the mask is copied out while
+// the lock is held.
+type sharedFace struct {
+	mu   sync.Mutex
+	face font.Face
+}
+
+func (f *sharedFace) Close() error { return nil }
+
+func (f *sharedFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dr, mask, maskp, advance, ok := f.face.Glyph(dot, r)
+	if !ok || mask == nil {
+		return dr, mask, maskp, advance, ok
+	}
+	alpha := image.NewAlpha(image.Rect(0, 0, dr.Dx(), dr.Dy()))
+	draw.Draw(alpha, alpha.Bounds(), mask, maskp, draw.Src)
+	return dr, alpha, image.Point{}, advance, ok
+}
+
+func (f *sharedFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.face.GlyphBounds(r)
+}
+
+func (f *sharedFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.face.GlyphAdvance(r)
+}
+
+func (f *sharedFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.face.Kern(r0, r1)
+}
+
+func (f *sharedFace) Metrics() font.Metrics {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.face.Metrics()
+}
+
+var (
+	emojiOnce  sync.Once
+	emojiNames map[string]struct{}
+)
+
+// HasEmoji reports whether a sprite exists for the emoji key, the code points
+// of the sequence in lowercase hex joined by dashes without U+FE0F, in the
+// override directory or among the embedded sprites.
+func HasEmoji(key string) bool {
+	mu.RLock()
+	dir := overrideDir
+	mu.RUnlock()
+	if dir != "" {
+		if _, err := os.Stat(filepath.Join(dir, "emoji", key+".png")); err == nil {
+			return true
+		}
+	}
+
+	emojiOnce.Do(func() {
+		entries, _ := embedded.ReadDir("emoji")
+		emojiNames = make(map[string]struct{}, len(entries))
+		for _, entry := range entries {
+			emojiNames[strings.TrimSuffix(entry.Name(), ".png")] = struct{}{}
+		}
+	})
+	_, ok := emojiNames[key]
+	return ok
+}
+
+// Emoji returns the sprite for an emoji key. Sprites can be overridden like
+// any other asset, e.g. with Twemoji's 72x72 set in an override directory.
+func Emoji(key string) (image.Image, error) {
+	return Image("emoji/" + key + ".png")
+}
+
+// Check is the result of loading one asset for Verify.
+type Check struct {
+	Name string
+	Err  error
+}
+
+// Verify loads every bundled font, as a face the way renders use it, and every
+// image, and reports how each one went.
+func Verify() []Check {
+	var checks []Check
+	for _, name := range Fonts {
+		_, err := Face(name, 16)
+		checks = append(checks, Check{Name: name, Err: err})
+	}
+	for _, name := range Images {
+		_, err := Image(name)
+		checks = append(checks, Check{Name: name, Err: err})
+	}
+	return checks
+}
@@ -0,0 +1,78 @@
+package assets
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHasEmojiChecksOverrideDir(t *testing.T) {
+	dir := t.TempDir()
+	SetOverrideDir(dir)
+	t.Cleanup(func() { SetOverrideDir("") })
+
+	// A sprite for a code point the embedded set does not have.
+	const key = "e000"
+	if !HasEmoji("1f004") {
+		t.Error("HasEmoji of an embedded sprite = false")
+	}
+	if HasEmoji(key) {
+		t.Fatalf("HasEmoji(%s) = true before it was added", key)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "emoji"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, "emoji", key+".png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 72, 72))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if !HasEmoji(key) {
+		t.Errorf("HasEmoji(%s) = false for a sprite in the override directory", key)
+	}
+	img, err := Emoji(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 72 {
+		t.Errorf("Emoji(%s) is %v, want the 72x72 override", key, img.Bounds())
+	}
+}
+
+func TestVerify(t *testing.T) {
+	for _, c := range Verify() {
+		if c.Err != nil {
+			t.Errorf("embedded %s: %v", c.Name, c.Err)
+		}
+	}
+	if got, want := len(Verify()), len(Fonts)+len(Images); got != want {
+		t.Errorf("Verify reported %d assets, want %d", got, want)
+	}
+
+	dir := t.TempDir()
+	SetOverrideDir(dir)
+	t.Cleanup(func() { SetOverrideDir("") })
+	for _, name := range []string{FontImpact, ImageJailBars} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("not an asset"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range Verify() {
+		broken := c.Name == FontImpact || c.Name == ImageJailBars
+		if (c.Err != nil) != broken {
+			t.Errorf("%s: error = %v, want one only for the broken overrides", c.Name, c.Err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Commit and BuildTime are set at build time, e.g.
+//
+//	go build -ldflags "-X jasper/buildinfo.Commit=$(git rev-parse HEAD) -X jasper/buildinfo.BuildTime=$(date -u +%FT%TZ)"
+//
+// When Commit is left empty the VCS revision recorded by the Go toolchain is used.
+var (
+	Commit    = ""
+	BuildTime = ""
+)
+
+type Info struct {
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+func Get() Info {
+	info := Info{
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}
@@ -0,0 +1,116 @@
+// Command emojigen extracts the colour bitmaps of an emoji font (e.g. Noto
+// Color Emoji) into Twemoji-style PNG sprites named after their code points,
+// such as 1f44d-1f3fd.png. Variation selector U+FE0F is dropped from names.
+//
+//	go run ./cmd/emojigen -font NotoColorEmoji.ttf -out assets/emoji -size 48
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/forPelevin/gomoji"
+	"github.com/go-text/typesetting/di"
+	"github.com/go-text/typesetting/font"
+	"github.com/go-text/typesetting/language"
+	"github.com/go-text/typesetting/shaping"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/fixed"
+
+	"jasper/emoji"
+)
+
+func main() {
+	fontPath := flag.String("font", "", "path to a CBDT/sbix colour emoji font")
+	outDir := flag.String("out", "assets/emoji", "output directory")
+	size := flag.Int("size", 48, "sprite size in pixels")
+	flag.Parse()
+
+	if *fontPath == "" {
+		log.Fatal("-font is required")
+	}
+
+	f, err := os.Open(*fontPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	face, err := font.ParseTTF(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		log.Fatal(err)
+	}
+
+	var shaper shaping.HarfbuzzShaper
+	written, missing := 0, 0
+	seen := make(map[string]bool)
+
+	// Every fully-qualified RGI sequence is shaped with the font; the ones that
+	// collapse into a single colour glyph become sprites.
+	for _, e := range gomoji.AllEmojis() {
+		name := emoji.Key(e.Character)
+		if seen[name] {
+			continue
+		}
+
+		text := []rune(e.Character)
+		output := shaper.Shape(shaping.Input{
+			Text:      text,
+			RunStart:  0,
+			RunEnd:    len(text),
+			Direction: di.DirectionLTR,
+			Face:      face,
+			Size:      fixed.I(72),
+			Script:    language.Common,
+		})
+		if len(output.Glyphs) != 1 {
+			missing++
+			continue
+		}
+		data, ok := face.GlyphData(output.Glyphs[0].GlyphID).(font.GlyphBitmap)
+		if !ok || data.Format != font.PNG {
+			missing++
+			continue
+		}
+		img, err := png.Decode(bytes.NewReader(data.Data))
+		if err != nil {
+			log.Printf("skipping %s: %v", name, err)
+			continue
+		}
+
+		dst := image.NewRGBA(image.Rect(0, 0, *size, *size))
+		draw.CatmullRom.Scale(dst, fit(img.Bounds(), *size), img, img.Bounds(), draw.Over, nil)
+
+		var buf bytes.Buffer
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := enc.Encode(&buf, dst); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(*outDir, name+".png"), buf.Bytes(), 0o644); err != nil {
+			log.Fatal(err)
+		}
+		seen[name] = true
+		written++
+	}
+	fmt.Printf("wrote %d sprites to %s (%d sequences did not shape to a colour glyph)\n", written, *outDir, missing)
+}
+
+// fit centres src inside a size×size square, preserving its aspect ratio.
+func fit(src image.Rectangle, size int) image.Rectangle {
+	w, h := src.Dx(), src.Dy()
+	if w >= h {
+		nh := h * size / w
+		return image.Rect(0, (size-nh)/2, size, (size-nh)/2+nh)
+	}
+	nw := w * size / h
+	return image.Rect((size-nw)/2, 0, (size-nw)/2+nw, size)
+}
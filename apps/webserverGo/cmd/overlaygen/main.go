@@ -0,0 +1,190 @@
+// Command overlaygen draws the overlays the avatar generators put on
+// avatars: the wanted poster's parchment, the jail bars and the gold and
+// rainbow frame rings. Any of them can be replaced by a PNG of the same name
+// in $JASPER_ASSETS_DIR/images.
+//
+//	go run ./cmd/overlaygen -out assets/images
+package main
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"math/rand/v2"
+	"path/filepath"
+
+	"github.com/fogleman/gg"
+)
+
+const (
+	posterWidth  = 600
+	posterHeight = 840
+	posterMargin = 36
+
+	jailSize    = 512
+	jailBars    = 6
+	jailBarSize = 26
+
+	frameSize = 512
+	frameRing = 30
+)
+
+func main() {
+	outDir := flag.String("out", "assets/images", "output directory")
+	flag.Parse()
+
+	overlays := map[string]image.Image{
+		"wanted_poster.png": parchment(),
+		"jail_bars.png":     bars(),
+		"frame_gold.png":    ring(goldRing),
+		"frame_rainbow.png": ring(rainbowRing),
+	}
+	for name, img := range overlays {
+		path := filepath.Join(*outDir, name)
+		if err := gg.SavePNG(path, img); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("wrote %s", path)
+	}
+}
+
+// parchment is aged paper: speckled, darker toward the edges and ruled with
+// a double border.
+func parchment() image.Image {
+	dc := gg.NewContext(posterWidth, posterHeight)
+	w, h := float64(posterWidth), float64(posterHeight)
+	dc.SetColor(color.NRGBA{R: 231, G: 211, B: 164, A: 255})
+	dc.Clear()
+
+	// A fixed seed draws the same poster every run.
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range int(w * h / 60) {
+		dc.SetRGBA(0.35, 0.22, 0.1, rng.Float64()*0.12)
+		dc.DrawPoint(rng.Float64()*w, rng.Float64()*h, rng.Float64()*1.5+0.5)
+		dc.Fill()
+	}
+
+	vignette := gg.NewRadialGradient(w/2, h/2, min(w, h)*0.3, w/2, h/2, max(w, h)*0.75)
+	vignette.AddColorStop(0, color.NRGBA{A: 0})
+	vignette.AddColorStop(1, color.NRGBA{R: 90, G: 55, B: 20, A: 150})
+	dc.SetFillStyle(vignette)
+	dc.DrawRectangle(0, 0, w, h)
+	dc.Fill()
+
+	dc.SetColor(color.NRGBA{R: 62, G: 39, B: 20, A: 255})
+	dc.SetLineWidth(4)
+	dc.DrawRectangle(posterMargin/2, posterMargin/2, w-posterMargin, h-posterMargin)
+	dc.Stroke()
+	dc.SetLineWidth(1.5)
+	dc.DrawRectangle(posterMargin/2+8, posterMargin/2+8, w-posterMargin-16, h-posterMargin-16)
+	dc.Stroke()
+	return dc.Image()
+}
+
+// bars are prison bars over a slightly darker cell, transparent between the
+// bars.
+func bars() image.Image {
+	dc := gg.NewContext(jailSize, jailSize)
+	const s = float64(jailSize)
+	dc.SetColor(color.NRGBA{A: 50})
+	dc.DrawRectangle(0, 0, s, s)
+	dc.Fill()
+
+	gap := s / jailBars
+	for i := range jailBars {
+		x := gap*(float64(i)+0.5) - jailBarSize/2
+		bar(dc, x, 0, jailBarSize, s, false)
+	}
+	bar(dc, 0, s*0.1, s, jailBarSize, true)
+	bar(dc, 0, s*0.9-jailBarSize, s, jailBarSize, true)
+	return dc.Image()
+}
+
+// bar draws a round steel bar as a gradient across it, with its shadow on
+// the image behind.
+func bar(dc *gg.Context, x, y, w, h float64, horizontal bool) {
+	dc.SetColor(color.NRGBA{A: 90})
+	dc.DrawRectangle(x+8, y+8, w, h)
+	dc.Fill()
+
+	var shade gg.Gradient
+	if horizontal {
+		shade = gg.NewLinearGradient(x, y, x, y+h)
+	} else {
+		shade = gg.NewLinearGradient(x, y, x+w, y)
+	}
+	shade.AddColorStop(0, color.NRGBA{R: 40, G: 42, B: 46, A: 255})
+	shade.AddColorStop(0.35, color.NRGBA{R: 190, G: 194, B: 200, A: 255})
+	shade.AddColorStop(0.5, color.NRGBA{R: 150, G: 154, B: 160, A: 255})
+	shade.AddColorStop(1, color.NRGBA{R: 30, G: 32, B: 36, A: 255})
+	dc.SetFillStyle(shade)
+	dc.DrawRectangle(x, y, w, h)
+	dc.Fill()
+}
+
+// ring draws a frame ring with stroke, with thin dark edges that set it off
+// from the avatar and the background. Inside and outside it is transparent.
+func ring(stroke func(dc *gg.Context, cx, cy, radius float64)) image.Image {
+	dc := gg.NewContext(frameSize, frameSize)
+	const s = float64(frameSize)
+	dc.SetLineWidth(frameRing)
+	stroke(dc, s/2, s/2, s/2-frameRing/2-1)
+
+	dc.SetColor(color.NRGBA{A: 90})
+	dc.SetLineWidth(2)
+	dc.DrawCircle(s/2, s/2, s/2-frameRing)
+	dc.Stroke()
+	dc.DrawCircle(s/2, s/2, s/2-2)
+	dc.Stroke()
+	return dc.Image()
+}
+
+func goldRing(dc *gg.Context, cx, cy, radius float64) {
+	gold := gg.NewLinearGradient(0, 0, frameSize, frameSize)
+	gold.AddColorStop(0, color.NRGBA{R: 255, G: 236, B: 150, A: 255})
+	gold.AddColorStop(0.45, color.NRGBA{R: 212, G: 160, B: 40, A: 255})
+	gold.AddColorStop(0.55, color.NRGBA{R: 245, G: 205, B: 90, A: 255})
+	gold.AddColorStop(1, color.NRGBA{R: 140, G: 95, B: 20, A: 255})
+	dc.SetStrokeStyle(gold)
+	dc.DrawCircle(cx, cy, radius)
+	dc.Stroke()
+}
+
+// rainbowRing goes through the hues around the circle in short overlapping
+// arcs. Round caps would bulge past the ring where they overlap.
+func rainbowRing(dc *gg.Context, cx, cy, radius float64) {
+	const steps = 180
+	dc.SetLineCapButt()
+	defer dc.SetLineCapRound()
+	for i := range steps {
+		a0 := 2 * math.Pi * float64(i) / steps
+		a1 := 2 * math.Pi * (float64(i) + 1.5) / steps
+		dc.SetColor(hsv(float64(i) * 360 / steps))
+		dc.DrawArc(cx, cy, radius, a0, a1)
+		dc.Stroke()
+	}
+}
+
+// hsv returns the fully saturated, full value color of the hue in degrees.
+func hsv(hue float64) color.Color {
+	h := math.Mod(hue, 360) / 60
+	x := 1 - math.Abs(math.Mod(h, 2)-1)
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g = 1, x
+	case 1:
+		r, g = x, 1
+	case 2:
+		g, b = 1, x
+	case 3:
+		g, b = x, 1
+	case 4:
+		r, b = x, 1
+	default:
+		r, b = 1, x
+	}
+	return color.NRGBA{R: uint8(r * 255), G: uint8(g * 255), B: uint8(b * 255), A: 255}
+}
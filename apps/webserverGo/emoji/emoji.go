@@ -0,0 +1,139 @@
+package emoji
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/rivo/uniseg"
+
+	"jasper/assets"
+)
+
+const defaultCDN = "https://cdn.discordapp.com"
+
+var customEmojiRegex = regexp.MustCompile(`<(a?):([A-Za-z0-9_~]{1,32}):(\d{15,21})>`)
+
+type Kind int
+
+const (
+	Text Kind = iota
+	Unicode
+	Custom
+)
+
+// Token is a piece of message text: plain text, a Unicode emoji with a bundled
+// sprite, or a Discord custom emoji.
+type Token struct {
+	Kind Kind
+	Text string
+
+	// Key names the sprite of a Unicode emoji.
+	Key string
+
+	// ID, Name and Animated describe a custom emoji.
+	ID       string
+	Name     string
+	Animated bool
+}
+
+// Key returns the sprite name for an emoji sequence: its code points in
+// lowercase hex joined by dashes, without U+FE0F.
+func Key(s string) string {
+	parts := make([]string, 0, len(s))
+	for _, r := range s {
+		if r == 0xfe0f {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%x", r))
+	}
+	return strings.Join(parts, "-")
+}
+
+// CDNBase is the base URL custom emoji are fetched from, configurable with
+// DISCORD_CDN_URL for proxies and tests.
+func CDNBase() string {
+	if base := os.Getenv("DISCORD_CDN_URL"); base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	return defaultCDN
+}
+
+// URL returns the image URL of a custom emoji. Animated emoji are requested as
+// their static first frame.
+func (t Token) URL() string {
+	return CDNBase() + "/emojis/" + t.ID + ".webp?size=96"
+}
+
+// Parse splits s into text, Unicode emoji and custom emoji tokens. Adjacent
+// text is merged into a single token.
+func Parse(s string) []Token {
+	var tokens []Token
+	appendText := func(text string) {
+		if text == "" {
+			return
+		}
+		if n := len(tokens); n > 0 && tokens[n-1].Kind == Text {
+			tokens[n-1].Text += text
+			return
+		}
+		tokens = append(tokens, Token{Kind: Text, Text: text})
+	}
+
+	last := 0
+	for _, m := range customEmojiRegex.FindAllStringSubmatchIndex(s, -1) {
+		parseUnicode(s[last:m[0]], appendText, &tokens)
+		tokens = append(tokens, Token{
+			Kind:     Custom,
+			Text:     s[m[0]:m[1]],
+			Animated: m[3] > m[2],
+			Name:     s[m[4]:m[5]],
+			ID:       s[m[6]:m[7]],
+		})
+		last = m[1]
+	}
+	parseUnicode(s[last:], appendText, &tokens)
+	return tokens
+}
+
+func parseUnicode(s string, appendText func(string), tokens *[]Token) {
+	state := -1
+	for len(s) > 0 {
+		var cluster string
+		cluster, s, _, state = uniseg.FirstGraphemeClusterInString(s, state)
+		if key := Key(cluster); isEmojiCandidate(cluster) && assets.HasEmoji(key) {
+			*tokens = append(*tokens, Token{Kind: Unicode, Text: cluster, Key: key})
+			continue
+		}
+		appendText(cluster)
+	}
+}
+
+// isEmojiCandidate filters out single code points that have a sprite but are
+// usually meant as text, such as ©, ™ or arrows, unless U+FE0F asks for emoji.
+func isEmojiCandidate(cluster string) bool {
+	runes := []rune(cluster)
+	if len(runes) > 1 {
+		return true
+	}
+	r := runes[0]
+	return r >= 0x1f000 || (r >= 0x2600 && r <= 0x27bf) || (r >= 0x2b00 && r <= 0x2bff) || r == 0x231a || r == 0x231b
+}
+
+// OnlyEmoji reports whether the tokens contain nothing but emoji and
+// whitespace, and how many emoji there are. Discord enlarges such messages.
+func OnlyEmoji(tokens []Token) (bool, int) {
+	count := 0
+	for _, t := range tokens {
+		switch t.Kind {
+		case Text:
+			if strings.TrimSpace(t.Text) != "" {
+				return false, 0
+			}
+		default:
+			count++
+		}
+	}
+	return count > 0, count
+}
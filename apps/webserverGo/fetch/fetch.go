@@ -0,0 +1,114 @@
+// Package fetch downloads the images a generator needs up front and in
+// parallel, so rendering does not wait on one download after another.
+package fetch
+
+import (
+	"context"
+	"image"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"jasper/tracing"
+	"jasper/utils"
+)
+
+// maxConcurrent bounds the downloads of one Prefetch call.
+const maxConcurrent = 6
+
+type result struct {
+	img image.Image
+	err error
+}
+
+type contextKey struct{}
+
+// set holds the outcome of every prefetched URL, failures included, so a
+// broken URL is not retried while rendering.
+type set struct {
+	parent  *set
+	results map[string]result
+}
+
+func (s *set) lookup(rawURL string) (result, bool) {
+	for ; s != nil; s = s.parent {
+		if r, ok := s.results[rawURL]; ok {
+			return r, true
+		}
+	}
+	return result{}, false
+}
+
+// Prefetch downloads urls concurrently and returns a context that Image
+// serves them from. Empty and duplicate URLs, and URLs already prefetched on
+// ctx, are skipped. Downloads stop when ctx is done; the URLs they were for
+// then fail with the context's error.
+func Prefetch(ctx context.Context, urls []string) context.Context {
+	parent, _ := ctx.Value(contextKey{}).(*set)
+
+	var pending []string
+	seen := make(map[string]struct{}, len(urls))
+	for _, rawURL := range urls {
+		if rawURL == "" {
+			continue
+		}
+		if _, ok := seen[rawURL]; ok {
+			continue
+		}
+		if _, ok := parent.lookup(rawURL); ok {
+			continue
+		}
+		seen[rawURL] = struct{}{}
+		pending = append(pending, rawURL)
+	}
+	if len(pending) == 0 {
+		return ctx
+	}
+
+	fetchCtx, span := tracing.Start(ctx, "fetch.Prefetch",
+		attribute.Int("fetch.urls", len(pending)),
+		attribute.Int("fetch.concurrency", maxConcurrent),
+	)
+	defer span.End()
+
+	results := make([]result, len(pending))
+	sem := make(chan struct{}, maxConcurrent)
+	var wg sync.WaitGroup
+	for i, rawURL := range pending {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-fetchCtx.Done():
+				results[i] = result{err: fetchCtx.Err()}
+				return
+			}
+			img, err := utils.LoadImageFromURL(fetchCtx, rawURL)
+			results[i] = result{img: img, err: err}
+		}()
+	}
+	wg.Wait()
+
+	s := &set{parent: parent, results: make(map[string]result, len(pending))}
+	failed := 0
+	for i, rawURL := range pending {
+		s.results[rawURL] = results[i]
+		if results[i].err != nil {
+			failed++
+		}
+	}
+	span.SetAttributes(attribute.Int("fetch.failed", failed))
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// Image returns the image at rawURL, from the prefetched set on ctx when it
+// is there and downloading it otherwise.
+func Image(ctx context.Context, rawURL string) (image.Image, error) {
+	s, _ := ctx.Value(contextKey{}).(*set)
+	if r, ok := s.lookup(rawURL); ok {
+		return r.img, r.err
+	}
+	return utils.LoadImageFromURL(ctx, rawURL)
+}
@@ -0,0 +1,309 @@
+package fonts
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"sync"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+
+	"jasper/assets"
+)
+
+const (
+	Sans   = "sans"
+	Serif  = "serif"
+	Impact = "impact"
+	Mono   = "mono"
+
+	// Discord families use gg sans, the font of the Discord client, for
+	// renders that imitate it.
+	Discord           = "discord"
+	DiscordBold       = "discord-bold"
+	DiscordItalic     = "discord-italic"
+	DiscordBoldItalic = "discord-bold-italic"
+)
+
+// Fallbacks is the chain appended to every built-in family. It is ordered from
+// the most to the least specific font, with Unifont as the last resort since it
+// covers the whole BMP in a pixel style.
+var Fallbacks = []string{
+	assets.FontNotoSansArabic,
+	assets.FontDejaVuSans,
+	assets.FontMPlus1p,
+	assets.FontEmojiOne,
+	assets.FontUnifont,
+}
+
+var (
+	mu       sync.RWMutex
+	families = map[string][]string{
+		Sans:   append([]string{assets.FontRoboto}, Fallbacks...),
+		Serif:  append([]string{assets.FontLiberationSerif}, Fallbacks...),
+		Impact: append([]string{assets.FontImpact}, Fallbacks...),
+		Mono:   append([]string{assets.FontDejaVuSansMono}, Fallbacks...),
+
+		Discord:           append([]string{assets.FontGGSans}, Fallbacks...),
+		DiscordBold:       append([]string{assets.FontGGSansBold}, Fallbacks...),
+		DiscordItalic:     append([]string{assets.FontGGSansItalic}, Fallbacks...),
+		DiscordBoldItalic: append([]string{assets.FontGGSansBoldItalic}, Fallbacks...),
+	}
+)
+
+// Register adds or replaces a family. The first font is the primary face and
+// the rest are tried in order for runes the primary has no glyph for.
+func Register(family string, chain ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	families[family] = chain
+}
+
+func Families() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Face returns a face for the family at the given size that falls back to the
+// next font in the chain, rune by rune, whenever a glyph is missing. The size
+// is rounded and clamped like assets.Face does; Size reports the result.
+func Face(family string, size float64) (*MultiFace, error) {
+	size = assets.FaceSize(size)
+	mu.RLock()
+	chain, ok := families[family]
+	mu.RUnlock()
+	if !ok || len(chain) == 0 {
+		return nil, fmt.Errorf("unknown font family %q", family)
+	}
+
+	m := &MultiFace{names: chain, size: size}
+	for _, name := range chain {
+		f, err := assets.Font(name)
+		if err != nil {
+			return nil, err
+		}
+		face, err := assets.Face(name, size)
+		if err != nil {
+			return nil, err
+		}
+		m.fonts = append(m.fonts, coverageFor(name, f))
+		m.faces = append(m.faces, face)
+	}
+	return m, nil
+}
+
+// MultiFace implements font.Face over a fallback chain, so gg measuring,
+// wrapping and drawing pick the right font without any extra work.
+type MultiFace struct {
+	names []string
+	size  float64
+	fonts []*coverage
+	faces []font.Face
+}
+
+// Run is a maximal substring drawn with a single face.
+type Run struct {
+	Text string
+	Font string
+	Face font.Face
+}
+
+// Runs splits s into runs of runes that resolve to the same face.
+func (m *MultiFace) Runs(s string) []Run {
+	var runs []Run
+	start, current := 0, -1
+	for i, r := range s {
+		idx := m.index(r)
+		if idx != current && i > start {
+			runs = append(runs, Run{Text: s[start:i], Font: m.names[current], Face: m.faces[current]})
+			start = i
+		}
+		current = idx
+	}
+	if start < len(s) {
+		runs = append(runs, Run{Text: s[start:], Font: m.names[current], Face: m.faces[current]})
+	}
+	return runs
+}
+
+// Glyph is a rune of a string laid out by Glyphs.
+type Glyph struct {
+	Rune rune
+	// X and Y offset the glyph's origin from the start of the string. Y is
+	// only set by Shape, for marks placed above or below their letter.
+	X, Y float64
+	// Segments outline the glyph around its origin, with y pointing down. They
+	// are nil for glyphs that have no outline, like bitmap emoji.
+	Segments sfnt.Segments
+}
+
+// Glyphs lays s out the way gg draws it and returns the outline of each rune,
+// so text can be stroked as well as filled.
+func (m *MultiFace) Glyphs(s string) []Glyph {
+	var (
+		buf    sfnt.Buffer
+		glyphs []Glyph
+		dot    fixed.Int26_6
+		prev   rune = -1
+	)
+	ppem := fixed.Int26_6(m.size * 64)
+	for _, r := range s {
+		if prev >= 0 {
+			dot += m.Kern(prev, r)
+		}
+		g := Glyph{Rune: r, X: float64(dot) / 64}
+		f := m.fonts[m.index(r)].font
+		if idx, err := f.GlyphIndex(&buf, r); err == nil {
+			if segments, err := f.LoadGlyph(&buf, idx, ppem, nil); err == nil {
+				// The segments live in buf until the next load.
+				g.Segments = append(sfnt.Segments{}, segments...)
+			}
+		}
+		glyphs = append(glyphs, g)
+		advance, _ := m.GlyphAdvance(r)
+		dot += advance
+		prev = r
+	}
+	return glyphs
+}
+
+// Size returns the size the face was created at.
+func (m *MultiFace) Size() float64 {
+	return m.size
+}
+
+// Primary returns the first face of the chain.
+func (m *MultiFace) Primary() font.Face {
+	return m.faces[0]
+}
+
+// Has reports whether any font in the chain has a glyph for r.
+func (m *MultiFace) Has(r rune) bool {
+	for _, c := range m.fonts {
+		if c.has(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// preferred sends runes to a font in the chain even when an earlier one has a
+// glyph for them: pictographs to the emoji font rather than DejaVu Sans's plain
+// emoticons, and Arabic to Noto Sans Arabic rather than DejaVu Sans Mono, whose
+// letters have no joining forms.
+var preferred = []struct {
+	lo, hi rune
+	font   string
+}{
+	{0x1F000, 0x1FAFF, assets.FontEmojiOne},
+	{0x0600, 0x06FF, assets.FontNotoSansArabic},
+	{0x0750, 0x077F, assets.FontNotoSansArabic},
+	{0x08A0, 0x08FF, assets.FontNotoSansArabic},
+	{0xFB50, 0xFDFF, assets.FontNotoSansArabic},
+	{0xFE70, 0xFEFF, assets.FontNotoSansArabic},
+}
+
+func (m *MultiFace) index(r rune) int {
+	// Whitespace stays on the primary face, and so do invisible formatting
+	// characters it has a glyph for, so they never pick up a visible
+	// placeholder glyph from a fallback.
+	if unicode.IsSpace(r) || ((unicode.Is(unicode.Cf, r) || unicode.Is(unicode.Mn, r)) && m.fonts[0].has(r)) {
+		return 0
+	}
+	for _, p := range preferred {
+		if r < p.lo || r > p.hi {
+			continue
+		}
+		for i, name := range m.names {
+			if name == p.font && m.fonts[i].has(r) {
+				return i
+			}
+		}
+	}
+	for i, c := range m.fonts {
+		if c.has(r) {
+			return i
+		}
+	}
+	return 0
+}
+
+func (m *MultiFace) Close() error { return nil }
+
+func (m *MultiFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return m.faces[m.index(r)].Glyph(dot, r)
+}
+
+func (m *MultiFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return m.faces[m.index(r)].GlyphBounds(r)
+}
+
+func (m *MultiFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return m.faces[m.index(r)].GlyphAdvance(r)
+}
+
+func (m *MultiFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	i := m.index(r0)
+	if i != m.index(r1) {
+		return 0
+	}
+	return m.faces[i].Kern(r0, r1)
+}
+
+func (m *MultiFace) Metrics() font.Metrics {
+	return m.faces[0].Metrics()
+}
+
+// coverage caches cmap lookups for a font, since the same runes are looked up
+// for every glyph of every render.
+type coverage struct {
+	mu    sync.RWMutex
+	font  *opentype.Font
+	runes map[rune]bool
+}
+
+var (
+	coverageMu sync.Mutex
+	coverages  = make(map[string]*coverage)
+)
+
+func coverageFor(name string, f *opentype.Font) *coverage {
+	coverageMu.Lock()
+	defer coverageMu.Unlock()
+
+	if c, ok := coverages[name]; ok && c.font == f {
+		return c
+	}
+	c := &coverage{font: f, runes: make(map[rune]bool)}
+	coverages[name] = c
+	return c
+}
+
+func (c *coverage) has(r rune) bool {
+	c.mu.RLock()
+	ok, cached := c.runes[r]
+	c.mu.RUnlock()
+	if cached {
+		return ok
+	}
+
+	var buf sfnt.Buffer
+	idx, err := c.font.GlyphIndex(&buf, r)
+	ok = err == nil && idx != 0
+
+	c.mu.Lock()
+	c.runes[r] = ok
+	c.mu.Unlock()
+	return ok
+}
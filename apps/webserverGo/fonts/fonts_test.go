@@ -0,0 +1,116 @@
+package fonts
+
+import (
+	"testing"
+
+	"jasper/assets"
+)
+
+func TestFallbacks(t *testing.T) {
+	tests := []struct {
+		text string
+		font string
+	}{
+		{"A", assets.FontRoboto},
+		{"م", assets.FontNotoSansArabic},
+		{"א", assets.FontDejaVuSans},
+		{"→", assets.FontDejaVuSans},
+		{"漢", assets.FontMPlus1p},
+		{"あ", assets.FontMPlus1p},
+		{"😀", assets.FontEmojiOne},
+		{"🍕", assets.FontEmojiOne},
+		{"ሀ", assets.FontUnifont},
+		{"ᚠ", assets.FontUnifont},
+	}
+
+	face, err := Face(Sans, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		runs := face.Runs(tt.text)
+		if len(runs) != 1 || runs[0].Font != tt.font {
+			t.Errorf("Runs(%q) = %+v, want one run in %s", tt.text, runs, tt.font)
+		}
+		if !face.Has([]rune(tt.text)[0]) {
+			t.Errorf("Has(%q) = false", tt.text)
+		}
+	}
+}
+
+func TestArabicSkipsMonoGlyphs(t *testing.T) {
+	face, err := Face(Mono, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := face.Runs("مرحبا")
+	if len(runs) != 1 || runs[0].Font != assets.FontNotoSansArabic {
+		t.Errorf("Runs = %+v, want one run in %s", runs, assets.FontNotoSansArabic)
+	}
+}
+
+func TestRunsSplitAtFallbacks(t *testing.T) {
+	face, err := Face(Impact, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Run{
+		{Text: "hi ", Font: assets.FontImpact},
+		{Text: "漢字", Font: assets.FontMPlus1p},
+		{Text: " ", Font: assets.FontImpact},
+		{Text: "😀", Font: assets.FontEmojiOne},
+	}
+	runs := face.Runs("hi 漢字 😀")
+	if len(runs) != len(want) {
+		t.Fatalf("got %d runs %+v, want %d", len(runs), runs, len(want))
+	}
+	for i, run := range runs {
+		if run.Text != want[i].Text || run.Font != want[i].Font {
+			t.Errorf("run %d = %q in %s, want %q in %s", i, run.Text, run.Font, want[i].Text, want[i].Font)
+		}
+	}
+}
+
+func TestFaceForEveryFamily(t *testing.T) {
+	for _, family := range Families() {
+		face, err := Face(family, 24)
+		if err != nil {
+			t.Errorf("Face(%s): %v", family, err)
+			continue
+		}
+		if face.Size() != 24 {
+			t.Errorf("Face(%s).Size() = %v, want 24", family, face.Size())
+		}
+		if m := face.Metrics(); m.Ascent <= 0 || m.Height <= 0 {
+			t.Errorf("Face(%s) metrics %+v", family, m)
+		}
+		advance, ok := face.GlyphAdvance('W')
+		if !ok || advance <= 0 {
+			t.Errorf("Face(%s) has no advance for W", family)
+		}
+		if glyphs := face.Glyphs("Hi"); len(glyphs) != 2 || glyphs[0].Segments == nil {
+			t.Errorf("Face(%s).Glyphs(\"Hi\") has no outlines", family)
+		}
+	}
+
+	if _, err := Face("no-such-family", 12); err == nil {
+		t.Error("Face of an unknown family succeeded")
+	}
+}
+
+func TestFaceSizeIsRounded(t *testing.T) {
+	face, err := Face(Sans, 17.4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if face.Size() != 17 {
+		t.Errorf("Size() = %v, want 17", face.Size())
+	}
+	huge, err := Face(Sans, 1e6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if huge.Size() != assets.MaxFaceSize {
+		t.Errorf("Size() = %v, want %v", huge.Size(), assets.MaxFaceSize)
+	}
+}
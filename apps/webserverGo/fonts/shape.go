@@ -0,0 +1,129 @@
+package fonts
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"unicode"
+
+	"github.com/go-text/typesetting/di"
+	gotext "github.com/go-text/typesetting/font"
+	"github.com/go-text/typesetting/language"
+	"github.com/go-text/typesetting/shaping"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+
+	"jasper/assets"
+)
+
+// shaper is a HarfBuzz shaper with a face of one font. Neither is safe for
+// concurrent use, so each font keeps a pool of them.
+type shaper struct {
+	face   *gotext.Face
+	shaper shaping.HarfbuzzShaper
+}
+
+var (
+	shapersMu sync.Mutex
+	shapers   = make(map[string]*sync.Pool)
+)
+
+func shaperPool(name string) (*sync.Pool, error) {
+	shapersMu.Lock()
+	defer shapersMu.Unlock()
+	if pool, ok := shapers[name]; ok {
+		return pool, nil
+	}
+
+	data, err := assets.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read font %s: %w", name, err)
+	}
+	face, err := gotext.ParseTTF(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font %s for shaping: %w", name, err)
+	}
+	f := face.Font
+	pool := &sync.Pool{New: func() any { return &shaper{face: gotext.NewFace(f)} }}
+	shapers[name] = pool
+	return pool, nil
+}
+
+// Shape lays out s, text of a single direction, with the shaping rules of its
+// script, like the joined letterforms of Arabic. The glyphs are in visual
+// order, left to right even for right-to-left text, and the width is their
+// total advance.
+func (m *MultiFace) Shape(s string, rtl bool) ([]Glyph, float64, error) {
+	direction := di.DirectionLTR
+	if rtl {
+		direction = di.DirectionRTL
+	}
+
+	runs := m.Runs(s)
+	if rtl {
+		for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+			runs[i], runs[j] = runs[j], runs[i]
+		}
+	}
+
+	var (
+		buf    sfnt.Buffer
+		glyphs []Glyph
+		dot    fixed.Int26_6
+	)
+	ppem := fixed.Int26_6(m.size * 64)
+	for _, run := range runs {
+		index := m.fontIndex(run.Font)
+		pool, err := shaperPool(run.Font)
+		if err != nil {
+			return nil, 0, err
+		}
+		text := []rune(run.Text)
+		sh := pool.Get().(*shaper)
+		out := sh.shaper.Shape(shaping.Input{
+			Text:      text,
+			RunStart:  0,
+			RunEnd:    len(text),
+			Direction: direction,
+			Face:      sh.face,
+			Size:      ppem,
+			Script:    scriptOf(text),
+		})
+		pool.Put(sh)
+
+		f := m.fonts[index].font
+		for _, g := range out.Glyphs {
+			glyph := Glyph{
+				Rune: text[g.ClusterIndex],
+				X:    float64(dot+g.XOffset) / 64,
+				Y:    -float64(g.YOffset) / 64,
+			}
+			if segments, err := f.LoadGlyph(&buf, sfnt.GlyphIndex(g.GlyphID), ppem, nil); err == nil {
+				glyph.Segments = append(sfnt.Segments{}, segments...)
+			}
+			glyphs = append(glyphs, glyph)
+			dot += g.Advance
+		}
+	}
+	return glyphs, float64(dot) / 64, nil
+}
+
+func (m *MultiFace) fontIndex(name string) int {
+	for i, n := range m.names {
+		if n == name {
+			return i
+		}
+	}
+	return 0
+}
+
+// scriptOf returns the script of the first letter of text, which is enough
+// for the runs of one font and direction that Shape is given.
+func scriptOf(text []rune) language.Script {
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			return language.LookupScript(r)
+		}
+	}
+	return language.Common
+}
@@ -0,0 +1,59 @@
+// Package avatar renders the avatar overlays of Discord fun bots: a wanted
+// poster, jail bars, a triggered animation and round frames. The poster's
+// parchment, the bars and the gold and rainbow rings are embedded images,
+// drawn by cmd/overlaygen and replaceable through the assets override
+// directory.
+package avatar
+
+import (
+	"context"
+	"image"
+	"image/draw"
+	"log/slog"
+
+	"github.com/fogleman/gg"
+
+	"jasper/assets"
+	"jasper/textlayout"
+	"jasper/utils"
+)
+
+// overlay loads the overlay image asset, scaled to width×height in case a
+// replacement has another size.
+func overlay(name string, width, height int) (image.Image, error) {
+	img, err := assets.Image(name)
+	if err != nil {
+		slog.Error("Failed to load overlay", "name", name, "error", err)
+		return nil, err
+	}
+	if b := img.Bounds(); b.Dx() == width && b.Dy() == height {
+		return img, nil
+	}
+	return utils.ResizeImageToFill(img, width, height), nil
+}
+
+// load fetches the avatar at URL and crops it to a size×size square.
+func load(ctx context.Context, URL string, size int) (*image.RGBA, error) {
+	img, err := utils.LoadImageFromURL(ctx, URL)
+	if err != nil {
+		slog.Error("Failed to load avatar from URL", "url", URL, "error", err)
+		return nil, err
+	}
+	square := utils.ResizeImageToFill(img, size, size)
+	if rgba, ok := square.(*image.RGBA); ok {
+		return rgba, nil
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(rgba, rgba.Bounds(), square, square.Bounds().Min, draw.Src)
+	return rgba, nil
+}
+
+// drawCentered draws the fitted lines centred on cx, the first line's top at
+// top and each next one lineHeight times the size below.
+func drawCentered(dc *gg.Context, text textlayout.Fitted, style textlayout.Style, lineHeight, cx, top float64) {
+	for i, line := range text.Lines {
+		w := textlayout.Measure(text.Face, line)
+		y := top + text.Size + float64(i)*text.Size*lineHeight
+		style.DrawString(dc, text.Face, line, cx-w/2, y)
+	}
+}
@@ -0,0 +1,166 @@
+package avatar
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/fogleman/gg"
+
+	"jasper/assets"
+	"jasper/fonts"
+	"jasper/textlayout"
+	"jasper/tracing"
+	"jasper/utils"
+)
+
+const (
+	FrameGold    = "gold"
+	FrameRainbow = "rainbow"
+
+	frameSize = 512
+	frameRing = 30
+)
+
+// Frame crops the avatar to a circle in a ring, gold, rainbow or of a
+// "#rrggbb" color, with text on a ribbon across its bottom. The corners are
+// transparent.
+func Frame(ctx context.Context, URL, ringName, text string) (image.Image, error) {
+	ctx, span := tracing.Start(ctx, "avatar.Frame")
+	defer span.End()
+
+	paint, err := parseRing(ringName)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	const s = float64(frameSize)
+	inner := s/2 - frameRing
+	photo, err := load(ctx, URL, int(2*inner))
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	var ringImage image.Image
+	if paint.image != "" {
+		ringImage, err = overlay(paint.image, frameSize, frameSize)
+		if err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+	}
+
+	var ribbon textlayout.Fitted
+	if text != "" {
+		ribbon, err = textlayout.Fit(fonts.Sans, text, 14, 40, 1, s*0.7, 48)
+		if err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	_, renderSpan := tracing.Start(ctx, "avatar.render")
+	defer renderSpan.End()
+	dc := gg.NewContext(frameSize, frameSize)
+
+	dc.DrawCircle(s/2, s/2, inner)
+	dc.Clip()
+	dc.DrawImageAnchored(photo, frameSize/2, frameSize/2, 0.5, 0.5)
+	dc.ResetClip()
+
+	if ringImage != nil {
+		dc.DrawImage(ringImage, 0, 0)
+	} else {
+		drawRing(dc, paint.pattern)
+	}
+
+	if text != "" {
+		lines := float64(len(ribbon.Lines))
+		height := lines*ribbon.Size + 24
+		width := 0.0
+		for _, line := range ribbon.Lines {
+			width = max(width, textlayout.Measure(ribbon.Face, line))
+		}
+		width += 48
+		top := s - frameRing - height
+		dc.SetFillStyle(paint.pattern)
+		dc.DrawRoundedRectangle((s-width)/2, top, width, height, height/2)
+		dc.Fill()
+		drawCentered(dc, ribbon, textlayout.Style{Fill: color.White, Shadow: color.NRGBA{A: 120}, ShadowOffset: 0.06}, 1, s/2, top+12-ribbon.Size*0.1)
+	}
+	return dc.Image(), nil
+}
+
+// ring is the paint of a frame's ring and ribbon.
+type ring struct {
+	pattern gg.Pattern
+	// image is the asset of the ring, or empty to draw it with pattern.
+	image string
+}
+
+func parseRing(name string) (ring, error) {
+	switch name {
+	case "", FrameGold:
+		gold := gg.NewLinearGradient(0, 0, frameSize, frameSize)
+		gold.AddColorStop(0, color.NRGBA{R: 255, G: 236, B: 150, A: 255})
+		gold.AddColorStop(0.45, color.NRGBA{R: 212, G: 160, B: 40, A: 255})
+		gold.AddColorStop(0.55, color.NRGBA{R: 245, G: 205, B: 90, A: 255})
+		gold.AddColorStop(1, color.NRGBA{R: 140, G: 95, B: 20, A: 255})
+		return ring{pattern: gold, image: assets.ImageFrameGold}, nil
+	case FrameRainbow:
+		rainbow := gg.NewLinearGradient(0, 0, frameSize, 0)
+		for i := 0; i <= 6; i++ {
+			rainbow.AddColorStop(float64(i)/6, hsv(float64(i)*60))
+		}
+		return ring{pattern: rainbow, image: assets.ImageFrameRainbow}, nil
+	}
+
+	c, err := utils.ParseHexColor(name)
+	if err != nil {
+		return ring{}, fmt.Errorf("invalid ring %q: must be %s, %s or a color", name, FrameGold, FrameRainbow)
+	}
+	return ring{pattern: gg.NewSolidPattern(c)}, nil
+}
+
+// drawRing draws a ring of the pattern round the edge of the frame, like the
+// ones in the ring assets.
+func drawRing(dc *gg.Context, pattern gg.Pattern) {
+	const s = float64(frameSize)
+	dc.SetStrokeStyle(pattern)
+	dc.SetLineWidth(frameRing)
+	dc.DrawCircle(s/2, s/2, s/2-frameRing/2-1)
+	dc.Stroke()
+
+	// Thin dark edges set the ring off from the avatar and the background.
+	dc.SetColor(color.NRGBA{A: 90})
+	dc.SetLineWidth(2)
+	dc.DrawCircle(s/2, s/2, s/2-frameRing)
+	dc.Stroke()
+	dc.DrawCircle(s/2, s/2, s/2-2)
+	dc.Stroke()
+}
+
+// hsv returns the fully saturated, full value color of the hue in degrees.
+func hsv(hue float64) color.Color {
+	h := math.Mod(hue, 360) / 60
+	x := 1 - math.Abs(math.Mod(h, 2)-1)
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g = 1, x
+	case 1:
+		r, g = x, 1
+	case 2:
+		g, b = 1, x
+	case 3:
+		g, b = x, 1
+	case 4:
+		r, b = x, 1
+	default:
+		r, b = 1, x
+	}
+	return color.NRGBA{R: uint8(r * 255), G: uint8(g * 255), B: uint8(b * 255), A: 255}
+}
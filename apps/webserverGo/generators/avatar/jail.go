@@ -0,0 +1,70 @@
+package avatar
+
+import (
+	"context"
+	"image"
+	"image/color"
+
+	"github.com/fogleman/gg"
+
+	"jasper/assets"
+	"jasper/fonts"
+	"jasper/generators/effects"
+	"jasper/textlayout"
+	"jasper/tracing"
+)
+
+const (
+	jailSize = 512
+	// jailBarSize is the height of the bottom crossbar of the bars overlay.
+	jailBarSize = 26
+)
+
+// Jail puts the avatar, grayed out, behind prison bars, with text on a
+// placard at the bottom.
+func Jail(ctx context.Context, URL, text string) (image.Image, error) {
+	ctx, span := tracing.Start(ctx, "avatar.Jail")
+	defer span.End()
+
+	photo, err := load(ctx, URL, jailSize)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	if _, err := (&effects.Grayscale{}).Apply(ctx, photo); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	bars, err := overlay(assets.ImageJailBars, jailSize, jailSize)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	var placard textlayout.Fitted
+	if text != "" {
+		placard, err = textlayout.Fit(fonts.Impact, text, 16, 48, 1.2, jailSize*0.8, 110)
+		if err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	_, renderSpan := tracing.Start(ctx, "avatar.render")
+	defer renderSpan.End()
+	dc := gg.NewContext(jailSize, jailSize)
+	dc.DrawImage(photo, 0, 0)
+	dc.DrawImage(bars, 0, 0)
+
+	const s = float64(jailSize)
+
+	if text != "" {
+		height := float64(len(placard.Lines))*placard.Size*1.2 + 20
+		top := s*0.9 - jailBarSize - 16 - height
+		dc.SetColor(color.NRGBA{R: 20, G: 20, B: 20, A: 220})
+		dc.DrawRoundedRectangle(s*0.08, top, s*0.84, height, 8)
+		dc.Fill()
+		drawCentered(dc, placard, textlayout.Style{Fill: color.White}, 1.2, s/2, top+10)
+	}
+	return dc.Image(), nil
+}
@@ -0,0 +1,76 @@
+package avatar
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math/rand/v2"
+
+	"github.com/fogleman/gg"
+
+	"jasper/fonts"
+	"jasper/textlayout"
+	"jasper/tracing"
+)
+
+const (
+	triggeredSize   = 256
+	triggeredFrames = 12
+	// TriggeredDelay is how long each frame shows, in hundredths of a second.
+	TriggeredDelay = 2
+	// triggeredShake is how far the avatar and banner jump each frame.
+	triggeredShake = 10
+	triggeredBand  = 56
+)
+
+// Triggered shakes the avatar, tinted red, above a banner reading text, or
+// TRIGGERED if text is empty. The frames loop with TriggeredDelay between
+// them.
+func Triggered(ctx context.Context, URL, text string) ([]image.Image, error) {
+	ctx, span := tracing.Start(ctx, "avatar.Triggered")
+	defer span.End()
+
+	// The avatar is larger than the frame so its edges stay out of view as it
+	// shakes.
+	photo, err := load(ctx, URL, triggeredSize+2*triggeredShake)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	if text == "" {
+		text = "TRIGGERED"
+	}
+	banner, err := textlayout.Fit(fonts.Impact, text, 14, triggeredBand*0.8, 1, triggeredSize-24, triggeredBand-8)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	_, renderSpan := tracing.Start(ctx, "avatar.render")
+	defer renderSpan.End()
+	// A fixed seed shakes the same way every time.
+	rng := rand.New(rand.NewPCG(1, 2))
+	shake := func() float64 { return (rng.Float64()*2 - 1) * triggeredShake }
+
+	frames := make([]image.Image, triggeredFrames)
+	for i := range frames {
+		if err := ctx.Err(); err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+		dc := gg.NewContext(triggeredSize, triggeredSize)
+		dc.SetColor(color.Black)
+		dc.Clear()
+		dc.DrawImage(photo, int(shake()-triggeredShake), int(shake()-triggeredShake))
+		dc.SetColor(color.NRGBA{R: 255, A: 90})
+		dc.DrawRectangle(0, 0, triggeredSize, triggeredSize)
+		dc.Fill()
+
+		bandTop := float64(triggeredSize-triggeredBand) + shake()/3
+		dc.SetColor(color.NRGBA{R: 220, G: 20, B: 20, A: 255})
+		dc.DrawRectangle(0, bandTop, triggeredSize, triggeredSize)
+		dc.Fill()
+		top := bandTop + (triggeredBand-float64(len(banner.Lines))*banner.Size)/2 - banner.Size*0.1
+		drawCentered(dc, banner, textlayout.Impact, 1, triggeredSize/2+shake()/2, top)
+		frames[i] = dc.Image()
+	}
+	return frames, nil
+}
@@ -0,0 +1,90 @@
+package avatar
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/fogleman/gg"
+
+	"jasper/assets"
+	"jasper/fonts"
+	"jasper/generators/effects"
+	"jasper/textlayout"
+	"jasper/tracing"
+)
+
+const (
+	posterWidth  = 600
+	posterHeight = 840
+	posterMargin = 36
+	posterPhoto  = 420
+)
+
+var inkBrown = color.NRGBA{R: 62, G: 39, B: 20, A: 255}
+
+// Wanted puts the avatar on an old west wanted poster, with name under it.
+func Wanted(ctx context.Context, URL, name string) (image.Image, error) {
+	ctx, span := tracing.Start(ctx, "avatar.Wanted")
+	defer span.End()
+
+	photo, err := load(ctx, URL, posterPhoto)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	paper, err := overlay(assets.ImageWantedPoster, posterWidth, posterHeight)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	if _, err := (&effects.Sepia{Amount: 0.85}).Apply(ctx, photo); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	_, layoutSpan := tracing.Start(ctx, "avatar.layout")
+	textWidth := float64(posterWidth - 2*posterMargin - 24)
+	title, err := textlayout.Fit(fonts.Serif, "WANTED", 40, 140, 1, textWidth, 140)
+	if err != nil {
+		layoutSpan.End()
+		return nil, tracing.RecordError(span, err)
+	}
+	subtitle, err := textlayout.Fit(fonts.Serif, "DEAD OR ALIVE", 20, 34, 1, textWidth, 40)
+	if err != nil {
+		layoutSpan.End()
+		return nil, tracing.RecordError(span, err)
+	}
+	var caption textlayout.Fitted
+	if name != "" {
+		caption, err = textlayout.Fit(fonts.Serif, strings.ToUpper(name), 20, 64, 1.1, textWidth, 130)
+		if err != nil {
+			layoutSpan.End()
+			return nil, tracing.RecordError(span, err)
+		}
+	}
+	layoutSpan.End()
+
+	if err := ctx.Err(); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	_, renderSpan := tracing.Start(ctx, "avatar.render")
+	defer renderSpan.End()
+	dc := gg.NewContext(posterWidth, posterHeight)
+	dc.DrawImage(paper, 0, 0)
+
+	ink := textlayout.Style{Fill: inkBrown}
+	drawCentered(dc, title, ink, 1, posterWidth/2, posterMargin+16)
+	photoTop := posterMargin + 16 + title.Size*1.05
+	drawCentered(dc, subtitle, ink, 1, posterWidth/2, photoTop)
+	photoTop += subtitle.Size * 1.5
+
+	photoX := float64(posterWidth-posterPhoto) / 2
+	dc.DrawImage(photo, int(photoX), int(photoTop))
+	dc.SetColor(inkBrown)
+	dc.SetLineWidth(6)
+	dc.DrawRectangle(photoX, photoTop, posterPhoto, posterPhoto)
+	dc.Stroke()
+
+	drawCentered(dc, caption, ink, 1.1, posterWidth/2, photoTop+posterPhoto+20)
+	return dc.Image(), nil
+}
@@ -0,0 +1,141 @@
+package effects
+
+import (
+	"context"
+	"errors"
+	"image"
+	"math"
+)
+
+// Blur is a Gaussian blur, Radius pixels of standard deviation.
+type Blur struct {
+	Radius float64 `json:"radius"`
+}
+
+func (b *Blur) Validate() error {
+	if b.Radius <= 0 || b.Radius > 100 {
+		return errors.New("radius must be greater than 0 and at most 100")
+	}
+	return nil
+}
+
+func (*Blur) MaxPixels() int { return neighbourPixels }
+
+// Apply approximates the Gaussian with three box blurs, which cost the same
+// at any radius.
+func (b *Blur) Apply(ctx context.Context, img *image.RGBA) (*image.RGBA, error) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	src := make([]float32, w*h*4)
+	for y := 0; y < h; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+w*4]
+		for i, v := range row {
+			src[y*w*4+i] = float32(v)
+		}
+	}
+	tmp := make([]float32, len(src))
+	for _, size := range boxSizes(b.Radius, 3) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		r := (size - 1) / 2
+		boxBlur(src, tmp, w, h, r, 4, w*4)
+		boxBlur(tmp, src, h, w, r, w*4, 4)
+	}
+	for y := 0; y < h; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+w*4]
+		for i := range row {
+			row[i] = uint8(min(max(src[y*w*4+i], 0), 255) + 0.5)
+		}
+	}
+	return img, nil
+}
+
+// boxSizes returns the widths of n box blurs that together approximate a
+// Gaussian of standard deviation sigma.
+func boxSizes(sigma float64, n int) []int {
+	ideal := math.Sqrt(12*sigma*sigma/float64(n) + 1)
+	lower := int(ideal)
+	if lower%2 == 0 {
+		lower--
+	}
+	upper := lower + 2
+	fl := float64(lower)
+	m := int(math.Round((12*sigma*sigma - float64(n)*fl*fl - 4*float64(n)*fl - 3*float64(n)) / (-4*fl - 4)))
+	sizes := make([]int, n)
+	for i := range sizes {
+		sizes[i] = upper
+		if i < m {
+			sizes[i] = lower
+		}
+	}
+	return sizes
+}
+
+// boxBlur averages each value of src with the r before and after it along one
+// axis into dst. Pixels are step apart along the axis and lines are stride
+// apart; the image's edge pixels repeat past it.
+func boxBlur(src, dst []float32, length, lines, r, step, stride int) {
+	scale := 1 / float32(2*r+1)
+	for line := 0; line < lines; line++ {
+		for c := 0; c < 4; c++ {
+			at := func(i int) float32 {
+				i = min(max(i, 0), length-1)
+				return src[line*stride+i*step+c]
+			}
+			var sum float32
+			for i := -r; i <= r; i++ {
+				sum += at(i)
+			}
+			for i := 0; i < length; i++ {
+				dst[line*stride+i*step+c] = sum * scale
+				sum += at(i+r+1) - at(i-r)
+			}
+		}
+	}
+}
+
+// Pixelate averages the image into squares Size pixels wide.
+type Pixelate struct {
+	Size int `json:"size"`
+}
+
+func (p *Pixelate) Validate() error {
+	if p.Size < 2 || p.Size > 256 {
+		return errors.New("size must be between 2 and 256")
+	}
+	return nil
+}
+
+func (*Pixelate) MaxPixels() int { return neighbourPixels }
+
+func (p *Pixelate) Apply(ctx context.Context, img *image.RGBA) (*image.RGBA, error) {
+	b := img.Bounds()
+	for y0 := b.Min.Y; y0 < b.Max.Y; y0 += p.Size {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		y1 := min(y0+p.Size, b.Max.Y)
+		for x0 := b.Min.X; x0 < b.Max.X; x0 += p.Size {
+			x1 := min(x0+p.Size, b.Max.X)
+			var sum [4]int
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					i := img.PixOffset(x, y)
+					for c := range sum {
+						sum[c] += int(img.Pix[i+c])
+					}
+				}
+			}
+			n := (x1 - x0) * (y1 - y0)
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					i := img.PixOffset(x, y)
+					for c := range sum {
+						img.Pix[i+c] = uint8((sum[c] + n/2) / n)
+					}
+				}
+			}
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,153 @@
+package effects
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/jpeg"
+	"math/rand/v2"
+)
+
+// Invert turns each color into its negative.
+type Invert struct{}
+
+func (*Invert) Validate() error { return nil }
+func (*Invert) MaxPixels() int  { return cheapPixels }
+
+func (*Invert) Apply(ctx context.Context, img *image.RGBA) (*image.RGBA, error) {
+	return img, mapPixels(ctx, img, func(r, g, b, a float64) (float64, float64, float64) {
+		return a - r, a - g, a - b
+	})
+}
+
+// Grayscale drops the colors, keeping their luminance.
+type Grayscale struct{}
+
+func (*Grayscale) Validate() error { return nil }
+func (*Grayscale) MaxPixels() int  { return cheapPixels }
+
+func (*Grayscale) Apply(ctx context.Context, img *image.RGBA) (*image.RGBA, error) {
+	return img, mapPixels(ctx, img, func(r, g, b, a float64) (float64, float64, float64) {
+		y := luma(r, g, b)
+		return y, y, y
+	})
+}
+
+// Sepia tones the image brown like an old photograph, Amount of the way.
+type Sepia struct {
+	Amount float64 `json:"amount"`
+}
+
+func (s *Sepia) Validate() error {
+	if s.Amount < 0 || s.Amount > 1 {
+		return errors.New("amount must be between 0 and 1")
+	}
+	return nil
+}
+
+func (*Sepia) MaxPixels() int { return cheapPixels }
+
+func (s *Sepia) Apply(ctx context.Context, img *image.RGBA) (*image.RGBA, error) {
+	return img, mapPixels(ctx, img, func(r, g, b, a float64) (float64, float64, float64) {
+		sr := 0.393*r + 0.769*g + 0.189*b
+		sg := 0.349*r + 0.686*g + 0.168*b
+		sb := 0.272*r + 0.534*g + 0.131*b
+		return lerp(r, sr, s.Amount), lerp(g, sg, s.Amount), lerp(b, sb, s.Amount)
+	})
+}
+
+// Deepfry oversaturates the image, boosts its contrast, adds noise and
+// crushes it with a low quality JPEG.
+type Deepfry struct {
+	// Saturation and Contrast multiply the image's own, 1 keeping it.
+	Saturation float64 `json:"saturation"`
+	Contrast   float64 `json:"contrast"`
+	// Noise is the strength of the grain, from 0 to 1.
+	Noise float64 `json:"noise"`
+	// Quality is the JPEG quality from 1 to 100, or 0 to skip the JPEG.
+	Quality int `json:"quality"`
+}
+
+func (d *Deepfry) Validate() error {
+	switch {
+	case d.Saturation < 0 || d.Saturation > 10:
+		return errors.New("saturation must be between 0 and 10")
+	case d.Contrast < 0 || d.Contrast > 10:
+		return errors.New("contrast must be between 0 and 10")
+	case d.Noise < 0 || d.Noise > 1:
+		return errors.New("noise must be between 0 and 1")
+	case d.Quality < 0 || d.Quality > 100:
+		return errors.New("quality must be between 1 and 100, or 0 for no JPEG")
+	}
+	return nil
+}
+
+func (*Deepfry) MaxPixels() int { return codecPixels }
+
+func (d *Deepfry) Apply(ctx context.Context, img *image.RGBA) (*image.RGBA, error) {
+	err := mapPixels(ctx, img, func(r, g, b, a float64) (float64, float64, float64) {
+		y := luma(r, g, b)
+		r, g, b = lerp(y, r, d.Saturation), lerp(y, g, d.Saturation), lerp(y, b, d.Saturation)
+		// Contrast stretches around middle gray, which is half the alpha when
+		// premultiplied.
+		mid := a / 2
+		r, g, b = mid+(r-mid)*d.Contrast, mid+(g-mid)*d.Contrast, mid+(b-mid)*d.Contrast
+		if d.Noise > 0 {
+			n := (rand.Float64()*2 - 1) * d.Noise * a
+			r, g, b = r+n, g+n, b+n
+		}
+		return r, g, b
+	})
+	if err != nil || d.Quality == 0 {
+		return img, err
+	}
+
+	// JPEG has no alpha, so transparent parts come back black, which suits
+	// the effect.
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: d.Quality}); err != nil {
+		return nil, err
+	}
+	fried, err := jpeg.Decode(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return toRGBA(fried), nil
+}
+
+// mapPixels replaces the color of every pixel of img with f of it. Colors are
+// premultiplied by alpha, from 0 to 255, and f's results are clamped between
+// 0 and the alpha.
+func mapPixels(ctx context.Context, img *image.RGBA, f func(r, g, b, a float64) (float64, float64, float64)) error {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		if y%64 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		row := img.Pix[img.PixOffset(b.Min.X, y):img.PixOffset(b.Max.X, y)]
+		for i := 0; i < len(row); i += 4 {
+			a := float64(row[i+3])
+			if a == 0 {
+				continue
+			}
+			r, g, bl := f(float64(row[i]), float64(row[i+1]), float64(row[i+2]), a)
+			row[i], row[i+1], row[i+2] = clamp(r, a), clamp(g, a), clamp(bl, a)
+		}
+	}
+	return nil
+}
+
+func luma(r, g, b float64) float64 {
+	return 0.299*r + 0.587*g + 0.114*b
+}
+
+func lerp(from, to, t float64) float64 {
+	return from + (to-from)*t
+}
+
+func clamp(v, limit float64) uint8 {
+	return uint8(min(max(v, 0), limit) + 0.5)
+}
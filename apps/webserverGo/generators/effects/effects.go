@@ -0,0 +1,177 @@
+// Package effects applies classic image bot effects, like deep frying and
+// blurring, as a pipeline of filters run one after another.
+package effects
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"log/slog"
+	"math"
+	"sort"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"jasper/tracing"
+	"jasper/utils"
+)
+
+// MaxOperations is the most operations a pipeline may have.
+const MaxOperations = 10
+
+// Filter is one operation of a pipeline. Its parameters are decoded from the
+// JSON object of the operation into the filter's fields, over its defaults.
+type Filter interface {
+	// Validate checks the parameters.
+	Validate() error
+	// MaxPixels is the largest image the filter runs on. Larger images are
+	// scaled down to it first, keeping their aspect ratio.
+	MaxPixels() int
+	// Apply runs the filter. It may change img in place and return it.
+	Apply(ctx context.Context, img *image.RGBA) (*image.RGBA, error)
+}
+
+const (
+	// Budgets for filters by cost: those that look at each pixel once, those
+	// that look at its neighbours too, and those that run a codec.
+	cheapPixels     = 16_000_000
+	neighbourPixels = 8_000_000
+	codecPixels     = 4_000_000
+)
+
+// filters makes each filter by name with its default parameters.
+var filters = map[string]func() Filter{
+	"deepfry":   func() Filter { return &Deepfry{Saturation: 2.5, Contrast: 1.6, Noise: 0.1, Quality: 8} },
+	"blur":      func() Filter { return &Blur{Radius: 5} },
+	"pixelate":  func() Filter { return &Pixelate{Size: 12} },
+	"invert":    func() Filter { return &Invert{} },
+	"grayscale": func() Filter { return &Grayscale{} },
+	"sepia":     func() Filter { return &Sepia{Amount: 1} },
+	"rotate":    func() Filter { return &Rotate{Degrees: 90} },
+	"flip":      func() Filter { return &Flip{} },
+	"mirror":    func() Filter { return &Mirror{} },
+}
+
+// Names lists the filters by name.
+func Names() []string {
+	names := make([]string, 0, len(filters))
+	for name := range filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Operation is a filter of a pipeline with its parameters.
+type Operation struct {
+	Name   string
+	Filter Filter
+}
+
+// Parse decodes a pipeline from its JSON operations, each an object naming
+// its filter in "op" beside the filter's parameters, and validates it.
+func Parse(raw []json.RawMessage) ([]Operation, error) {
+	if len(raw) == 0 {
+		return nil, errors.New("operations cannot be empty")
+	}
+	if len(raw) > MaxOperations {
+		return nil, fmt.Errorf("operations are limited to %d", MaxOperations)
+	}
+	ops := make([]Operation, len(raw))
+	for i, r := range raw {
+		var head struct {
+			Op string `json:"op"`
+		}
+		if err := json.Unmarshal(r, &head); err != nil {
+			return nil, fmt.Errorf("operation %d: must be an object", i+1)
+		}
+		newFilter, ok := filters[head.Op]
+		if !ok {
+			return nil, fmt.Errorf("operation %d: unknown op %q", i+1, head.Op)
+		}
+		f := newFilter()
+		if err := json.Unmarshal(r, f); err != nil {
+			return nil, fmt.Errorf("operation %d (%s): invalid parameters", i+1, head.Op)
+		}
+		if err := f.Validate(); err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i+1, head.Op, err)
+		}
+		ops[i] = Operation{Name: head.Op, Filter: f}
+	}
+	return ops, nil
+}
+
+// GenImage loads the image at URL and runs the operations on it in order.
+func GenImage(ctx context.Context, URL string, ops []Operation) (image.Image, error) {
+	ctx, span := tracing.Start(ctx, "effects.GenImage", attribute.Int("effects.operations", len(ops)))
+	defer span.End()
+
+	img, err := utils.LoadImageFromURL(ctx, URL)
+	if err != nil {
+		slog.Error("Failed to load image from URL", "url", URL, "error", err)
+		return nil, tracing.RecordError(span, err)
+	}
+
+	// Shrinking once to what the most generous filter takes spares every
+	// filter a copy of the full image.
+	budget := 0
+	for _, op := range ops {
+		budget = max(budget, op.Filter.MaxPixels())
+	}
+	if shrunk, ok := shrink(img, budget); ok {
+		span.SetAttributes(attribute.Int("effects.scaled_width", shrunk.Bounds().Dx()), attribute.Int("effects.scaled_height", shrunk.Bounds().Dy()))
+		img = shrunk
+	}
+
+	out := toRGBA(img)
+	for _, op := range ops {
+		if err := ctx.Err(); err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+		out, err = apply(ctx, op, out)
+		if err != nil {
+			slog.Error("Failed to apply effect", "op", op.Name, "error", err)
+			return nil, tracing.RecordError(span, err)
+		}
+	}
+	return out, nil
+}
+
+func apply(ctx context.Context, op Operation, img *image.RGBA) (*image.RGBA, error) {
+	ctx, span := tracing.Start(ctx, "effects."+op.Name)
+	defer span.End()
+
+	if shrunk, ok := shrink(img, op.Filter.MaxPixels()); ok {
+		span.SetAttributes(attribute.Int("effects.scaled_width", shrunk.Bounds().Dx()), attribute.Int("effects.scaled_height", shrunk.Bounds().Dy()))
+		img = toRGBA(shrunk)
+	}
+	out, err := op.Filter.Apply(ctx, img)
+	return out, tracing.RecordError(span, err)
+}
+
+// shrink scales img down to at most budget pixels, keeping its aspect ratio.
+// It reports false and leaves img alone if it is within the budget.
+func shrink(img image.Image, budget int) (image.Image, bool) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w*h <= budget {
+		return img, false
+	}
+	scale := math.Sqrt(float64(budget) / float64(w*h))
+	w, h = max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale))
+	return utils.ResizeImage(img, w, h), true
+}
+
+// toRGBA returns img as an RGBA image starting at the origin, copying it
+// unless it already is one.
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
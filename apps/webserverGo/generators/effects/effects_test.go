@@ -0,0 +1,41 @@
+package effects
+
+import (
+	"encoding/json"
+	"image"
+	"testing"
+)
+
+func TestShrink(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	if got, ok := shrink(img, 80_000); ok || got != image.Image(img) {
+		t.Error("shrink changed an image within its budget")
+	}
+	got, ok := shrink(img, 20_000)
+	if !ok {
+		t.Fatal("shrink left an image over its budget")
+	}
+	if b := got.Bounds(); b.Dx() != 200 || b.Dy() != 100 {
+		t.Errorf("shrunk to %dx%d, want 200x100", b.Dx(), b.Dy())
+	}
+}
+
+func TestParse(t *testing.T) {
+	raw := []json.RawMessage{
+		json.RawMessage(`{"op": "blur", "radius": 3}`),
+		json.RawMessage(`{"op": "invert"}`),
+	}
+	ops, err := Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 2 || ops[0].Name != "blur" || ops[0].Filter.(*Blur).Radius != 3 || ops[1].Name != "invert" {
+		t.Errorf("Parse = %+v", ops)
+	}
+
+	for _, bad := range []string{`"blur"`, `{"op": "melt"}`, `{"op": "blur", "radius": "big"}`} {
+		if _, err := Parse([]json.RawMessage{json.RawMessage(bad)}); err == nil {
+			t.Errorf("Parse(%s) succeeded", bad)
+		}
+	}
+}
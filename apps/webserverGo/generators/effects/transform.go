@@ -0,0 +1,85 @@
+package effects
+
+import (
+	"context"
+	"errors"
+	"image"
+	"math"
+
+	"github.com/fogleman/gg"
+)
+
+// Rotate turns the image Degrees clockwise. Quarter turns are exact, and
+// other angles grow the canvas to fit the image, leaving the corners
+// transparent.
+type Rotate struct {
+	Degrees float64 `json:"degrees"`
+}
+
+func (r *Rotate) Validate() error {
+	if r.Degrees < -360 || r.Degrees > 360 {
+		return errors.New("degrees must be between -360 and 360")
+	}
+	return nil
+}
+
+func (*Rotate) MaxPixels() int { return neighbourPixels }
+
+func (r *Rotate) Apply(ctx context.Context, img *image.RGBA) (*image.RGBA, error) {
+	degrees := math.Mod(r.Degrees+360, 360)
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	switch degrees {
+	case 0:
+		return img, nil
+	case 90:
+		return remap(img, h, w, func(x, y int) (int, int) { return y, h - 1 - x }), nil
+	case 180:
+		return remap(img, w, h, func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }), nil
+	case 270:
+		return remap(img, h, w, func(x, y int) (int, int) { return w - 1 - y, x }), nil
+	}
+
+	angle := gg.Radians(degrees)
+	sin, cos := math.Abs(math.Sin(angle)), math.Abs(math.Cos(angle))
+	outW := int(math.Ceil(float64(w)*cos + float64(h)*sin))
+	outH := int(math.Ceil(float64(w)*sin + float64(h)*cos))
+	dc := gg.NewContext(outW, outH)
+	dc.RotateAbout(angle, float64(outW)/2, float64(outH)/2)
+	dc.DrawImageAnchored(img, outW/2, outH/2, 0.5, 0.5)
+	return toRGBA(dc.Image()), nil
+}
+
+// Flip turns the image upside down.
+type Flip struct{}
+
+func (*Flip) Validate() error { return nil }
+func (*Flip) MaxPixels() int  { return cheapPixels }
+
+func (*Flip) Apply(ctx context.Context, img *image.RGBA) (*image.RGBA, error) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, w, h, func(x, y int) (int, int) { return x, h - 1 - y }), nil
+}
+
+// Mirror flips the image left to right.
+type Mirror struct{}
+
+func (*Mirror) Validate() error { return nil }
+func (*Mirror) MaxPixels() int  { return cheapPixels }
+
+func (*Mirror) Apply(ctx context.Context, img *image.RGBA) (*image.RGBA, error) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, w, h, func(x, y int) (int, int) { return w - 1 - x, y }), nil
+}
+
+// remap returns a width×height image whose pixel (x, y) is img's pixel at
+// src(x, y).
+func remap(img *image.RGBA, width, height int, src func(x, y int) (int, int)) *image.RGBA {
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sx, sy := src(x, y)
+			copy(out.Pix[out.PixOffset(x, y):out.PixOffset(x, y)+4], img.Pix[img.PixOffset(sx, sy):img.PixOffset(sx, sy)+4])
+		}
+	}
+	return out
+}
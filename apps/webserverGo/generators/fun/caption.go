@@ -1,108 +1,210 @@
 package fun
 
 import (
+	"context"
+	"fmt"
 	"image"
+	"image/color"
 	"log/slog"
-	"strings"
+	"sort"
 
 	"github.com/fogleman/gg"
+	"go.opentelemetry.io/otel/attribute"
 
+	"jasper/fonts"
+	"jasper/textlayout"
+	"jasper/tracing"
 	"jasper/utils"
 )
 
 const (
-	fontPath   = "./fonts/impact.ttf"
-	lineHeight = 1.5
-	textMargin = 30
+	CaptionBar            = "bar"
+	CaptionModern         = "modern"
+	CaptionDemotivational = "demotivational"
+	CaptionSubtitle       = "subtitle"
 )
 
-func wrapText(dc *gg.Context, text string, maxWidth float64) []string {
-	words := strings.Fields(text)
-	var lines []string
-	if len(words) == 0 {
-		return lines
+// Caption is the text MakeCaptionImage puts on an image and how.
+type Caption struct {
+	// Style names the layout, one of CaptionStyles. Empty is CaptionBar.
+	Style string
+	Text  string
+	// Subtitle is the smaller line under the title of a demotivational
+	// poster. Other styles have no use for it.
+	Subtitle string
+	// Position puts a bar or modern caption above the image, "top", or
+	// below it, "bottom". Empty is "top".
+	Position string
+	// FontSize is in pixels, or textlayout.AutoFontSize to fit the text.
+	FontSize  float64
+	TextStyle textlayout.StyleOptions
+}
+
+// captionLayout is one of the caption styles. Each puts the text around or on
+// the image its own way.
+type captionLayout interface {
+	// textStyle is the style of the text before a request's overrides.
+	textStyle() textlayout.Style
+	render(ctx context.Context, img image.Image, caption Caption, style textlayout.Style) (image.Image, error)
+}
+
+var captionLayouts = map[string]captionLayout{
+	CaptionBar:            barCaption{},
+	CaptionModern:         modernCaption{},
+	CaptionDemotivational: demotivationalCaption{},
+	CaptionSubtitle:       subtitleCaption{},
+}
+
+// CaptionStyles lists the caption styles by name.
+func CaptionStyles() []string {
+	names := make([]string, 0, len(captionLayouts))
+	for name := range captionLayouts {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
 
-	var line string
-	for _, word := range words {
-		testLine := line
-		if testLine != "" {
-			testLine += " "
-		}
-		testLine += word
-
-		width, _ := dc.MeasureString(testLine)
-		if width > maxWidth && line != "" {
-			lines = append(lines, line)
-			line = word
-		} else {
-			line = testLine
-		}
+func (c Caption) layout() (captionLayout, error) {
+	if c.Style == "" {
+		return captionLayouts[CaptionBar], nil
 	}
-	if line != "" {
-		lines = append(lines, line)
+	layout, ok := captionLayouts[c.Style]
+	if !ok {
+		return nil, fmt.Errorf("unknown caption style %q", c.Style)
+	}
+	return layout, nil
+}
+
+// ResolveStyle returns the text style of the caption: its layout's style with
+// TextStyle applied on top.
+func (c Caption) ResolveStyle() (textlayout.Style, error) {
+	layout, err := c.layout()
+	if err != nil {
+		return textlayout.Style{}, err
 	}
-	return lines
+	return layout.textStyle().With(c.TextStyle)
 }
 
-func MakeCaptionImage(URL string, fontSize float64, caption string, position string) (image.Image, error) {
-	img, err := utils.LoadImageFromURL(URL)
+func MakeCaptionImage(ctx context.Context, URL string, caption Caption) (image.Image, error) {
+	ctx, span := tracing.Start(ctx, "fun.MakeCaptionImage", attribute.String("caption.style", caption.Style))
+	defer span.End()
+
+	layout, err := caption.layout()
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	style, err := caption.ResolveStyle()
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	img, err := utils.LoadImageFromURL(ctx, URL)
 	if err != nil {
 		slog.Error("Failed to load image from URL", "url", URL, "error", err)
-		return nil, err
+		return nil, tracing.RecordError(span, err)
+	}
+
+	out, err := layout.render(ctx, img, caption, style)
+	if err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return out, nil
+}
+
+// fitCaption wraps text to width at fontSize or, with AutoFontSize, at the
+// largest size between minSize and maxSize that fits in maxHeight.
+func fitCaption(family, text string, fontSize, minSize, maxSize, lineHeight, width, maxHeight float64) (textlayout.Fitted, error) {
+	if fontSize == textlayout.AutoFontSize {
+		return textlayout.Fit(family, text, minSize, maxSize, lineHeight, width, maxHeight)
 	}
+	face, err := fonts.Face(family, fontSize)
+	if err != nil {
+		slog.Error("Failed to load font", "family", family, "error", err)
+		return textlayout.Fitted{}, err
+	}
+	return textlayout.Fitted{Size: face.Size(), Face: face, Lines: textlayout.Wrap(face, text, width)}, nil
+}
+
+// blockHeight is the height of the fitted lines, lineHeight times the size
+// apart.
+func blockHeight(text textlayout.Fitted, lineHeight float64) float64 {
+	return float64(len(text.Lines)) * text.Size * lineHeight
+}
+
+// drawLines draws the fitted lines from top down, centred between x and
+// x+width or, with start set, from the side each line's direction starts at.
+func drawLines(dc *gg.Context, text textlayout.Fitted, style textlayout.Style, lineHeight, x, width, top float64, start bool) {
+	for i, line := range text.Lines {
+		w := textlayout.Measure(text.Face, line)
+		lx := x + (width-w)/2
+		if start {
+			// Each line starts at the side of its own direction, as when it
+			// is reordered.
+			lx = x
+			if textlayout.RTL(line) {
+				lx = x + width - w
+			}
+		}
+		y := top + text.Size + float64(i)*text.Size*lineHeight
+		style.DrawString(dc, text.Face, line, lx, y)
+	}
+}
+
+// barCaption is the classic caption: black Impact text in a white bar above
+// or below the image.
+type barCaption struct{}
+
+const (
+	lineHeight = 1.5
+	textMargin = 30
 
+	// With textlayout.AutoFontSize the caption is set as large as fits a bar
+	// of at most this share of the image height, but no smaller than
+	// autoMinFontSize and no larger than an eighth of the image width.
+	autoBarHeight   = 0.35
+	autoMinFontSize = 12
+)
+
+func (barCaption) textStyle() textlayout.Style {
+	return textlayout.Style{Fill: color.Black}
+}
+
+func (barCaption) render(ctx context.Context, img image.Image, caption Caption, style textlayout.Style) (image.Image, error) {
 	imgWidth := img.Bounds().Dx()
 	imgHeight := img.Bounds().Dy()
 
-	dc := gg.NewContext(imgWidth, 1000)
-	font, err := utils.LoadFont("./fonts/impact.ttf", fontSize)
+	_, layoutSpan := tracing.Start(ctx, "caption.layout")
+	maxTextWidth := float64(imgWidth - 40)
+	barHeight := float64(imgHeight)*autoBarHeight - 2*textMargin
+	text, err := fitCaption(fonts.Impact, caption.Text, caption.FontSize, autoMinFontSize, float64(imgWidth)/8, lineHeight, maxTextWidth, barHeight)
+	layoutSpan.End()
 	if err != nil {
-		slog.Error("Failed to load font", "fontPath", fontPath, "error", err)
 		return nil, err
 	}
-	dc.SetFontFace(font)
-
-	maxTextWidth := float64(imgWidth - 40)
-	lines := wrapText(dc, caption, maxTextWidth)
-	lineHeightPx := fontSize * lineHeight
-	textHeight := float64(len(lines)) * lineHeightPx
+	textHeight := blockHeight(text, lineHeight)
 	boxHeight := int(textHeight + float64(2*textMargin))
 	totalHeight := boxHeight + imgHeight
 
-	dc = gg.NewContext(imgWidth, totalHeight)
-	if err := dc.LoadFontFace(fontPath, fontSize); err != nil {
-		slog.Error("Failed to load font face", "fontPath", fontPath, "error", err)
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	dc.SetRGB(1, 1, 1)
-	if position == "top" {
-		dc.DrawRectangle(0, 0, float64(imgWidth), float64(boxHeight))
-	} else {
-		dc.DrawRectangle(0, float64(imgHeight), float64(imgWidth), float64(boxHeight))
-	}
-	dc.Fill()
+	_, renderSpan := tracing.Start(ctx, "caption.render")
+	defer renderSpan.End()
+	dc := gg.NewContext(imgWidth, totalHeight)
 
-	dc.SetRGB(0, 0, 0)
-	var startY float64
-	if position == "top" {
-		startY = float64(boxHeight)/2 - textHeight/2 + fontSize
-	} else {
-		startY = float64(imgHeight) + float64(boxHeight)/2 - textHeight/2 + fontSize
-	}
-	for i, line := range lines {
-		w, _ := dc.MeasureString(line)
-		x := float64(imgWidth)/2 - w/2
-		y := startY + float64(i)*lineHeightPx
-		dc.DrawString(line, x, y)
+	boxTop, imgTop := 0, boxHeight
+	if caption.Position == "bottom" {
+		boxTop, imgTop = imgHeight, 0
 	}
+	dc.SetRGB(1, 1, 1)
+	dc.DrawRectangle(0, float64(boxTop), float64(imgWidth), float64(boxHeight))
+	dc.Fill()
 
-	if position == "top" {
-		dc.DrawImageAnchored(img, imgWidth/2, boxHeight+imgHeight/2, 0.5, 0.5)
-	} else {
-		dc.DrawImageAnchored(img, imgWidth/2, imgHeight/2, 0.5, 0.5)
-	}
+	top := float64(boxTop) + float64(boxHeight)/2 - textHeight/2
+	drawLines(dc, text, style, lineHeight, 0, float64(imgWidth), top, false)
 
+	dc.DrawImageAnchored(img, imgWidth/2, imgTop+imgHeight/2, 0.5, 0.5)
 	return dc.Image(), nil
 }
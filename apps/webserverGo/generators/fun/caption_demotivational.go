@@ -0,0 +1,86 @@
+package fun
+
+import (
+	"context"
+	"image"
+	"image/color"
+
+	"github.com/fogleman/gg"
+
+	"jasper/fonts"
+	"jasper/textlayout"
+	"jasper/tracing"
+)
+
+// demotivationalCaption is the demotivational poster: the image framed by a
+// thin white line on black, with a large serif title and a smaller subtitle
+// under it.
+type demotivationalCaption struct{}
+
+const (
+	posterLineHeight = 1.2
+	// posterMargin is the black around the image, as a share of its width.
+	posterMargin = 0.12
+	// The subtitle is set at this share of the title size.
+	posterSubtitleScale = 0.4
+)
+
+func (demotivationalCaption) textStyle() textlayout.Style {
+	return textlayout.Style{Fill: color.White}
+}
+
+func (demotivationalCaption) render(ctx context.Context, img image.Image, caption Caption, style textlayout.Style) (image.Image, error) {
+	imgWidth := float64(img.Bounds().Dx())
+	imgHeight := float64(img.Bounds().Dy())
+
+	_, layoutSpan := tracing.Start(ctx, "caption.layout")
+	margin := max(20, imgWidth*posterMargin)
+	frameGap, frameWidth := max(3, imgWidth*0.01), max(2, imgWidth*0.004)
+	width := imgWidth + margin
+	title, err := fitCaption(fonts.Serif, caption.Text, caption.FontSize, 14, imgWidth*0.14, posterLineHeight, width, imgHeight*0.35)
+	if err != nil {
+		layoutSpan.End()
+		return nil, err
+	}
+	var subtitle textlayout.Fitted
+	if caption.Subtitle != "" {
+		// An auto sized subtitle may shrink further if it is long.
+		size := title.Size * posterSubtitleScale
+		fontSize := size
+		if caption.FontSize == textlayout.AutoFontSize {
+			fontSize = textlayout.AutoFontSize
+		}
+		subtitle, err = fitCaption(fonts.Serif, caption.Subtitle, fontSize, 10, size, posterLineHeight, width, imgHeight*0.25)
+		if err != nil {
+			layoutSpan.End()
+			return nil, err
+		}
+	}
+	layoutSpan.End()
+
+	imgTop := margin * 0.6
+	titleTop := imgTop + imgHeight + margin*0.45
+	subtitleTop := titleTop + blockHeight(title, posterLineHeight) + title.Size*0.2
+	height := subtitleTop + blockHeight(subtitle, posterLineHeight) + margin*0.5
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	_, renderSpan := tracing.Start(ctx, "caption.render")
+	defer renderSpan.End()
+	canvasWidth := imgWidth + 2*margin
+	dc := gg.NewContext(int(canvasWidth), int(height))
+	dc.SetRGB(0, 0, 0)
+	dc.Clear()
+
+	dc.DrawImage(img, int(margin), int(imgTop))
+	dc.SetRGB(1, 1, 1)
+	dc.SetLineWidth(frameWidth)
+	dc.DrawRectangle(margin-frameGap, imgTop-frameGap, imgWidth+2*frameGap, imgHeight+2*frameGap)
+	dc.Stroke()
+
+	drawLines(dc, title, style, posterLineHeight, margin/2, width, titleTop, false)
+	drawLines(dc, subtitle, style, posterLineHeight, margin/2, width, subtitleTop, false)
+	return dc.Image(), nil
+}
@@ -0,0 +1,65 @@
+package fun
+
+import (
+	"context"
+	"image"
+	"image/color"
+
+	"github.com/fogleman/gg"
+
+	"jasper/fonts"
+	"jasper/textlayout"
+	"jasper/tracing"
+)
+
+// modernCaption is the caption of social media reposts: dark sans-serif text
+// on white, aligned to the side it starts at, above or below the image.
+type modernCaption struct{}
+
+const (
+	modernLineHeight = 1.3
+	// modernPadding surrounds the text, as a share of the image width.
+	modernPadding = 0.05
+	// With textlayout.AutoFontSize the text fits at most this share of the
+	// image height, at no more than a twelfth of the image width.
+	modernAutoHeight = 0.4
+)
+
+func (modernCaption) textStyle() textlayout.Style {
+	return textlayout.Style{Fill: color.NRGBA{R: 15, G: 20, B: 25, A: 255}}
+}
+
+func (modernCaption) render(ctx context.Context, img image.Image, caption Caption, style textlayout.Style) (image.Image, error) {
+	imgWidth := img.Bounds().Dx()
+	imgHeight := img.Bounds().Dy()
+
+	_, layoutSpan := tracing.Start(ctx, "caption.layout")
+	pad := max(12, float64(imgWidth)*modernPadding)
+	width := float64(imgWidth) - 2*pad
+	text, err := fitCaption(fonts.Sans, caption.Text, caption.FontSize, autoMinFontSize, float64(imgWidth)/12, modernLineHeight, width, float64(imgHeight)*modernAutoHeight)
+	layoutSpan.End()
+	if err != nil {
+		return nil, err
+	}
+	textHeight := blockHeight(text, modernLineHeight)
+	// The last line's spacing stands in for the padding under it.
+	boxHeight := int(pad + textHeight + pad - text.Size*(modernLineHeight-1))
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	_, renderSpan := tracing.Start(ctx, "caption.render")
+	defer renderSpan.End()
+	dc := gg.NewContext(imgWidth, boxHeight+imgHeight)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+
+	boxTop, imgTop := 0, boxHeight
+	if caption.Position == "bottom" {
+		boxTop, imgTop = imgHeight, 0
+	}
+	drawLines(dc, text, style, modernLineHeight, pad, width, float64(boxTop)+pad, true)
+	dc.DrawImage(img, 0, imgTop)
+	return dc.Image(), nil
+}
@@ -0,0 +1,59 @@
+package fun
+
+import (
+	"context"
+	"image"
+	"image/color"
+
+	"github.com/fogleman/gg"
+
+	"jasper/fonts"
+	"jasper/textlayout"
+	"jasper/tracing"
+)
+
+// subtitleCaption sets the text over the bottom of the image like film
+// subtitles, leaving the image its size.
+type subtitleCaption struct{}
+
+const (
+	subtitleLineHeight = 1.25
+	// subtitleMargin keeps the text off the bottom and sides, as a share of
+	// the image height and width.
+	subtitleMargin = 0.06
+	// With textlayout.AutoFontSize the text fits at most this share of the
+	// image height, at no more than a sixteenth of the image width.
+	subtitleAutoHeight = 0.3
+)
+
+func (subtitleCaption) textStyle() textlayout.Style {
+	return textlayout.Style{Fill: color.White, Stroke: color.Black, StrokeWidth: 0.12}
+}
+
+func (subtitleCaption) render(ctx context.Context, img image.Image, caption Caption, style textlayout.Style) (image.Image, error) {
+	imgWidth := float64(img.Bounds().Dx())
+	imgHeight := float64(img.Bounds().Dy())
+
+	_, layoutSpan := tracing.Start(ctx, "caption.layout")
+	sideMargin := imgWidth * subtitleMargin
+	width := imgWidth - 2*sideMargin
+	text, err := fitCaption(fonts.Sans, caption.Text, caption.FontSize, 10, imgWidth/16, subtitleLineHeight, width, imgHeight*subtitleAutoHeight)
+	layoutSpan.End()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	_, renderSpan := tracing.Start(ctx, "caption.render")
+	defer renderSpan.End()
+	dc := gg.NewContext(int(imgWidth), int(imgHeight))
+	dc.DrawImage(img, 0, 0)
+
+	// The last line sits on the margin, without the spacing under it.
+	top := imgHeight*(1-subtitleMargin) - blockHeight(text, subtitleLineHeight) + text.Size*(subtitleLineHeight-1)
+	drawLines(dc, text, style, subtitleLineHeight, sideMargin, width, top, false)
+	return dc.Image(), nil
+}
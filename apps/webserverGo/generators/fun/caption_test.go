@@ -0,0 +1,185 @@
+package fun
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"slices"
+	"testing"
+
+	"jasper/golden"
+)
+
+// solidImage returns a w by h image filled with c.
+func solidImage(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+// sameColor reports whether a and b are within a few levels of each other on
+// every channel.
+func sameColor(a, b color.Color) bool {
+	ar, ag, ab, _ := a.RGBA()
+	br, bg, bb, _ := b.RGBA()
+	near := func(x, y uint32) bool { return max(x, y)-min(x, y) < 0x0800 }
+	return near(ar, br) && near(ag, bg) && near(ab, bb)
+}
+
+var captionBase = color.RGBA{R: 70, G: 110, B: 160, A: 255}
+
+func TestCaptionStyles(t *testing.T) {
+	want := []string{CaptionBar, CaptionDemotivational, CaptionModern, CaptionSubtitle}
+	if got := CaptionStyles(); !slices.Equal(got, want) {
+		t.Errorf("CaptionStyles() = %q, want %q", got, want)
+	}
+	if layout, err := (Caption{}).layout(); err != nil || layout != captionLayouts[CaptionBar] {
+		t.Errorf("empty style = %v, %v, want the bar caption", layout, err)
+	}
+	if _, err := (Caption{Style: "marquee"}).layout(); err == nil {
+		t.Error("unknown style was accepted")
+	}
+}
+
+func TestCaptionPosition(t *testing.T) {
+	const w, h = 400, 300
+	base := solidImage(w, h, captionBase)
+	for _, style := range []string{CaptionBar, CaptionModern} {
+		for _, position := range []string{"", "top", "bottom"} {
+			layout := captionLayouts[style]
+			img, err := layout.render(context.Background(), base, Caption{Style: style, Text: "hello there", Position: position, FontSize: 24}, layout.textStyle())
+			if err != nil {
+				t.Fatalf("%s %q: %v", style, position, err)
+			}
+			b := img.Bounds()
+			if b.Dx() != w || b.Dy() <= h {
+				t.Fatalf("%s %q is %v, want %d wide and taller than %d", style, position, b, w, h)
+			}
+			// The caption is white, so the image is on the other side of it.
+			top, bottom := img.At(1, 1), img.At(1, b.Dy()-2)
+			wantTop, wantBottom := color.Color(color.White), color.Color(captionBase)
+			if position == "bottom" {
+				wantTop, wantBottom = wantBottom, wantTop
+			}
+			if !sameColor(top, wantTop) || !sameColor(bottom, wantBottom) {
+				t.Errorf("%s %q: top is %v and bottom %v, want %v and %v", style, position, top, bottom, wantTop, wantBottom)
+			}
+		}
+	}
+}
+
+func TestSubtitleCaptionStaysOnTheImage(t *testing.T) {
+	const w, h = 400, 300
+	layout := captionLayouts[CaptionSubtitle]
+	img, err := layout.render(context.Background(), solidImage(w, h, captionBase), Caption{Style: CaptionSubtitle, Text: "hello there", FontSize: 24}, layout.textStyle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != w || b.Dy() != h {
+		t.Fatalf("subtitle caption is %v, want the %dx%d image", b, w, h)
+	}
+	// The text is white, so only the bottom of the image has any.
+	textTop, textBottom := h, -1
+	for y := range h {
+		for x := range w {
+			if sameColor(img.At(x, y), color.White) {
+				textTop, textBottom = min(textTop, y), max(textBottom, y)
+			}
+		}
+	}
+	if textBottom < 0 {
+		t.Fatal("no text was drawn")
+	}
+	if textTop < h/2 || textBottom >= h-int(h*subtitleMargin)+2 {
+		t.Errorf("text spans rows %d..%d, want it above the bottom margin of a %d high image", textTop, textBottom, h)
+	}
+}
+
+func TestDemotivationalCaptionFramesTheImage(t *testing.T) {
+	const w, h = 400, 300
+	base := solidImage(w, h, captionBase)
+	layout := captionLayouts[CaptionDemotivational]
+	render := func(caption Caption) image.Image {
+		t.Helper()
+		caption.Style = CaptionDemotivational
+		img, err := layout.render(context.Background(), base, caption, layout.textStyle())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img
+	}
+
+	title := render(Caption{Text: "Motivation", FontSize: 40})
+	b := title.Bounds()
+	if b.Dx() <= w || b.Dy() <= h {
+		t.Fatalf("poster is %v, want it larger than the %dx%d image", b, w, h)
+	}
+	if c := title.At(1, 1); !sameColor(c, color.Black) {
+		t.Errorf("poster background is %v, want black", c)
+	}
+	margin := max(20, w*posterMargin)
+	if c := title.At(int(margin)+w/2, int(margin*0.6)+h/2); !sameColor(c, captionBase) {
+		t.Errorf("poster center is %v, want the image", c)
+	}
+
+	subtitled := render(Caption{Text: "Motivation", Subtitle: "it's not a thing", FontSize: 40})
+	if subtitled.Bounds().Dx() != b.Dx() || subtitled.Bounds().Dy() <= b.Dy() {
+		t.Errorf("poster with a subtitle is %v, want it taller than %v", subtitled.Bounds(), b)
+	}
+}
+
+func TestModernCaptionAlignsToStart(t *testing.T) {
+	tests := []struct {
+		text string
+		// side is where the caption should sit.
+		side string
+	}{
+		{"hi", "left"},
+		{"hi שלום", "left"},
+		{"שלום", "right"},
+		{"مرحبا", "right"},
+		{"מחיר 100", "right"},
+		{"שלום (hi)", "right"},
+	}
+	const w, h = 600, 200
+	white := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(white, white.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	layout := modernCaption{}
+	for _, tt := range tests {
+		img, err := layout.render(context.Background(), white, Caption{Text: tt.text, FontSize: 32}, layout.textStyle())
+		if err != nil {
+			t.Fatalf("render(%q): %v", tt.text, err)
+		}
+		left, right := img.Bounds().Max.X, -1
+		for y := range img.Bounds().Dy() {
+			for x := range w {
+				if r, _, _, _ := img.At(x, y).RGBA(); r < 0x8000 {
+					left, right = min(left, x), max(right, x)
+				}
+			}
+		}
+		if right < left {
+			t.Fatalf("render(%q) drew no text", tt.text)
+		}
+		if center := (left + right) / 2; tt.side == "left" && center > w/2 || tt.side == "right" && center < w/2 {
+			t.Errorf("caption %q spans %d..%d, want it on the %s", tt.text, left, right, tt.side)
+		}
+	}
+}
+
+func TestCaptionMixedDirectionGolden(t *testing.T) {
+	const text = "hello שלום עולם world\nمرحبا بالعالم 123 hello\nמחיר 100 ₪ (הנחה)"
+	base := image.NewRGBA(image.Rect(0, 0, 500, 200))
+	draw.Draw(base, base.Bounds(), image.NewUniform(color.RGBA{R: 70, G: 110, B: 160, A: 255}), image.Point{}, draw.Src)
+
+	for _, style := range []string{CaptionBar, CaptionModern} {
+		layout := captionLayouts[style]
+		img, err := layout.render(context.Background(), base, Caption{Style: style, Text: text, FontSize: 28}, layout.textStyle())
+		if err != nil {
+			t.Fatalf("%s: %v", style, err)
+		}
+		golden.Assert(t, "bidi-"+style, img)
+	}
+}
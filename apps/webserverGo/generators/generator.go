@@ -0,0 +1,170 @@
+// Package generators defines the interface every image generator implements
+// and the registry the /fun routes are served from.
+package generators
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// InvalidParamsError is returned for errors caused by the request rather than
+// the render, such as a malformed body or a failed validation.
+type InvalidParamsError struct {
+	Err error
+}
+
+func (e *InvalidParamsError) Error() string { return e.Err.Error() }
+func (e *InvalidParamsError) Unwrap() error { return e.Err }
+
+// Generator renders an image from parameters of type P, which is decoded from
+// the JSON request body. The json, desc and required struct tags of P describe
+// its parameters in the index.
+type Generator[P any] interface {
+	Description() string
+	Validate(params *P) error
+	Render(ctx context.Context, params *P) (image.Image, error)
+}
+
+// GIF is a rendered image served as a GIF instead of a PNG, for animations
+// and for clients that ask for one. Each frame shows for Delay hundredths of a
+// second. As an image.Image it is its first frame.
+type GIF struct {
+	Frames []image.Image
+	Delay  int
+}
+
+func (g *GIF) ColorModel() color.Model { return g.Frames[0].ColorModel() }
+func (g *GIF) Bounds() image.Rectangle { return g.Frames[0].Bounds() }
+func (g *GIF) At(x, y int) color.Color { return g.Frames[0].At(x, y) }
+
+// Param describes one parameter of a generator.
+type Param struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Required    bool   `json:"required,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Info describes a registered generator.
+type Info struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Params      []Param `json:"params"`
+}
+
+type entry struct {
+	info   Info
+	render func(ctx context.Context, body io.Reader) (image.Image, error)
+}
+
+type Registry struct {
+	entries map[string]entry
+}
+
+func NewRegistry() *Registry {
+	return &Registry{entries: make(map[string]entry)}
+}
+
+// Register adds g under name. It panics on duplicate names, which are
+// programming errors.
+func Register[P any](r *Registry, name string, g Generator[P]) {
+	if _, ok := r.entries[name]; ok {
+		panic(fmt.Sprintf("generators: %q registered twice", name))
+	}
+	r.entries[name] = entry{
+		info: Info{Name: name, Description: g.Description(), Params: paramsOf(reflect.TypeFor[P]())},
+		render: func(ctx context.Context, body io.Reader) (image.Image, error) {
+			params := new(P)
+			if err := json.NewDecoder(body).Decode(params); err != nil {
+				return nil, &InvalidParamsError{Err: errors.New("Invalid request body")}
+			}
+			if err := g.Validate(params); err != nil {
+				return nil, &InvalidParamsError{Err: err}
+			}
+			return g.Render(ctx, params)
+		},
+	}
+}
+
+// Has reports whether a generator is registered under name.
+func (r *Registry) Has(name string) bool {
+	_, ok := r.entries[name]
+	return ok
+}
+
+// Render decodes body into the parameters of the named generator, validates
+// them and renders the image.
+func (r *Registry) Render(ctx context.Context, name string, body io.Reader) (image.Image, error) {
+	e, ok := r.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown generator %q", name)
+	}
+	return e.render(ctx, body)
+}
+
+// Index lists the registered generators by name.
+func (r *Registry) Index() []Info {
+	infos := make([]Info, 0, len(r.entries))
+	for _, e := range r.entries {
+		infos = append(infos, e.info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// paramsOf lists the JSON fields of a params struct, flattening embedded
+// structs the way encoding/json does.
+func paramsOf(t reflect.Type) []Param {
+	var params []Param
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			params = append(params, paramsOf(field.Type)...)
+			continue
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		params = append(params, Param{
+			Name:        name,
+			Type:        typeName(field.Type),
+			Required:    field.Tag.Get("required") == "true",
+			Description: field.Tag.Get("desc"),
+		})
+	}
+	return params
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+func typeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return "string"
+	case t.Kind() == reflect.String:
+		return "string"
+	case t.Kind() == reflect.Bool:
+		return "boolean"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Float64:
+		return "number"
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return "array"
+	}
+	return "object"
+}
@@ -1,106 +1,103 @@
 package meme
 
 import (
+	"context"
 	"image"
 	"log/slog"
-	"strings"
 
 	"github.com/fogleman/gg"
 
+	"jasper/fonts"
+	"jasper/textlayout"
+	"jasper/tracing"
 	"jasper/utils"
 )
 
 const (
-	fontPath   = "./fonts/impact.ttf"
 	lineHeight = 1.5
 	textMargin = 30
-)
 
-func drawOutlined(dc *gg.Context, text string, x float64, y float64) {
-	dc.SetRGB(0, 0, 0)
-	offsets := []image.Point{
-		{X: -2, Y: -2},
-		{X: 2, Y: -2},
-		{X: -2, Y: 2},
-		{X: 2, Y: 2},
-	}
-	for _, off := range offsets {
-		dc.DrawString(text, x+float64(off.X), y+float64(off.Y))
-	}
-	dc.SetRGB(1, 1, 1)
-	dc.DrawString(text, x, y)
-}
+	// With textlayout.AutoFontSize the top and bottom texts each fit a band
+	// of this share of the image height, at sizes in these bounds. The upper
+	// bound is for a 500px wide image, like an explicit font size.
+	autoBandHeight  = 0.25
+	autoMinFontSize = 12
+	autoMaxFontSize = 64
+)
 
-func wrapText(dc *gg.Context, text string, maxWidth float64) []string {
-	words := strings.Fields(text)
-	var lines []string
-	if len(words) == 0 {
-		return lines
+// layoutText wraps one of the top and bottom texts, at fontSize or, with
+// textlayout.AutoFontSize, at the largest size that fits its band of the image.
+func layoutText(text string, fontSize float64, imgWidth, imgHeight int) (textlayout.Fitted, error) {
+	maxTextWidth := float64(imgWidth - 40)
+	if fontSize == textlayout.AutoFontSize {
+		bandHeight := float64(imgHeight)*autoBandHeight - textMargin
+		maxSize := float64(imgWidth) * autoMaxFontSize / 500.0
+		return textlayout.Fit(fonts.Impact, text, autoMinFontSize, maxSize, lineHeight, maxTextWidth, bandHeight)
 	}
 
-	var line string
-	for _, word := range words {
-		testLine := line
-		if testLine != "" {
-			testLine += " "
-		}
-		testLine += word
-
-		width, _ := dc.MeasureString(testLine)
-		if width > maxWidth && line != "" {
-			lines = append(lines, line)
-			line = word
-		} else {
-			line = testLine
-		}
-	}
-	if line != "" {
-		lines = append(lines, line)
+	fontSize = fontSize * float64(imgWidth) / 500.0
+	font, err := fonts.Face(fonts.Impact, fontSize)
+	if err != nil {
+		slog.Error("Failed to load font", "family", fonts.Impact, "error", err)
+		return textlayout.Fitted{}, err
 	}
-	return lines
+	return textlayout.Fitted{Size: font.Size(), Face: font, Lines: textlayout.Wrap(font, text, maxTextWidth)}, nil
 }
 
-func GenImage(URL string, fontSize float64, topText string, bottomText string) (image.Image, error) {
-	img, err := utils.LoadImageFromURL(URL)
+// GenImage sets topText and bottomText over the image in style, classically
+// textlayout.Impact.
+func GenImage(ctx context.Context, URL string, fontSize float64, topText string, bottomText string, style textlayout.Style) (image.Image, error) {
+	ctx, span := tracing.Start(ctx, "meme.GenImage")
+	defer span.End()
+
+	img, err := utils.LoadImageFromURL(ctx, URL)
 	if err != nil {
 		slog.Error("Failed to load image from URL", "url", URL, "error", err)
-		return nil, err
+		return nil, tracing.RecordError(span, err)
 	}
 
 	imgWidth := img.Bounds().Dx()
 	imgHeight := img.Bounds().Dy()
 
-	fontSize = fontSize * float64(imgWidth) / 500.0
 	dc := gg.NewContext(imgWidth, imgHeight)
-	font, err := utils.LoadFont("./fonts/impact.ttf", fontSize)
-	if err != nil {
-		slog.Error("Failed to load font", "fontPath", fontPath, "error", err)
-		return nil, err
+	var top, bottom textlayout.Fitted
+	if topText != "" {
+		if top, err = layoutText(topText, fontSize, imgWidth, imgHeight); err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+	}
+	if bottomText != "" {
+		if bottom, err = layoutText(bottomText, fontSize, imgWidth, imgHeight); err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
 	}
-	dc.DrawImage(img, 0, 0)
-	dc.SetFontFace(font)
 
-	maxTextWidth := float64(imgWidth - 40)
-	lineHeightPx := fontSize * lineHeight
+	if err := ctx.Err(); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
 
-	if topText != "" {
-		lines := wrapText(dc, topText, maxTextWidth)
-		for i, line := range lines {
-			w, _ := dc.MeasureString(line)
+	_, renderSpan := tracing.Start(ctx, "meme.render")
+	defer renderSpan.End()
+	dc.DrawImage(img, 0, 0)
+
+	if len(top.Lines) > 0 {
+		lineHeightPx := top.Size * lineHeight
+		for i, line := range top.Lines {
+			w := textlayout.Measure(top.Face, line)
 			x := float64(imgWidth)/2 - w/2
-			y := float64(textMargin) + float64(i)*lineHeightPx + fontSize
-			drawOutlined(dc, line, x, y)
+			y := float64(textMargin) + float64(i)*lineHeightPx + top.Size
+			style.DrawString(dc, top.Face, line, x, y)
 		}
 	}
 
-	if bottomText != "" {
-		lines := wrapText(dc, bottomText, maxTextWidth)
-		textHeight := float64(len(lines)) * lineHeightPx
-		for i, line := range lines {
-			w, _ := dc.MeasureString(line)
+	if len(bottom.Lines) > 0 {
+		lineHeightPx := bottom.Size * lineHeight
+		textHeight := float64(len(bottom.Lines)) * lineHeightPx
+		for i, line := range bottom.Lines {
+			w := textlayout.Measure(bottom.Face, line)
 			x := float64(imgWidth)/2 - w/2
-			y := float64(imgHeight) - textMargin - textHeight + fontSize + float64(i)*lineHeightPx
-			drawOutlined(dc, line, x, y)
+			y := float64(imgHeight) - textMargin - textHeight + bottom.Size + float64(i)*lineHeightPx
+			style.DrawString(dc, bottom.Face, line, x, y)
 		}
 	}
 	return dc.Image(), nil
@@ -0,0 +1,43 @@
+package meme
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"jasper/golden"
+	"jasper/textlayout"
+)
+
+// mixedLines mix Hebrew, Arabic, Latin and numbers, so their goldens show
+// Arabic joining and the visual order of the runs.
+var mixedLines = []string{
+	"hello שלום עולם world",
+	"مرحبا بالعالم 123 hello",
+	"מחיר 100 ₪ (הנחה)",
+	"العدد 42 في (القائمة)",
+}
+
+func TestGenImageMixedDirectionGolden(t *testing.T) {
+	base := image.NewRGBA(image.Rect(0, 0, 500, 400))
+	for y := range 400 {
+		for x := range 500 {
+			base.Set(x, y, color.RGBA{R: uint8(x / 2), G: 90, B: uint8(y / 2), A: 255})
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		png.Encode(w, base)
+	}))
+	defer server.Close()
+
+	img, err := GenImage(context.Background(), server.URL+"/base.png", 36, mixedLines[0], mixedLines[1], textlayout.Impact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.Assert(t, "bidi-meme", img)
+}
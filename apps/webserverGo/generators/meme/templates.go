@@ -0,0 +1,238 @@
+package meme
+
+import (
+	"cmp"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/fogleman/gg"
+	"go.opentelemetry.io/otel/attribute"
+
+	"jasper/assets"
+	"jasper/fetch"
+	"jasper/fonts"
+	"jasper/textlayout"
+	"jasper/tracing"
+)
+
+// Box is a region of a template that one text is fitted into. Its position
+// and size are fractions of the template image, so the same layout works at
+// any resolution.
+type Box struct {
+	Label  string  `json:"label"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	// Align is left, center or right.
+	Align string `json:"align"`
+	// MaxFontSize is in pixels for a 500px wide image, like the font size of
+	// GenImage. Longer texts are set smaller to fit the box.
+	MaxFontSize float64 `json:"maxFontSize"`
+	Color       string  `json:"color"`
+	// Outline is the color of the text outline, if any.
+	Outline string `json:"outline,omitempty"`
+	// Rotation turns the box clockwise around its centre, in degrees.
+	Rotation float64 `json:"rotation,omitempty"`
+}
+
+// Template is a meme base image with the boxes its texts go into.
+type Template struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// URL is where the image is fetched from when it is not an asset and
+	// FetchTemplates is on.
+	URL   string `json:"url"`
+	Boxes []Box  `json:"boxes"`
+}
+
+// Asset names the template image among the assets, which a JASPER_ASSETS_DIR
+// provides.
+func (t Template) Asset() string {
+	return "images/templates/" + t.ID + ".jpg"
+}
+
+//go:embed templates.json
+var templatesJSON []byte
+
+const (
+	minTemplateFontSize = 8
+	// boxPadding keeps text off the edges of its box, as a fraction of the
+	// box's shorter side.
+	boxPadding = 0.05
+)
+
+var (
+	templates      = mustLoadTemplates()
+	templateImages sync.Map
+)
+
+func mustLoadTemplates() map[string]Template {
+	var list []Template
+	if err := json.Unmarshal(templatesJSON, &list); err != nil {
+		panic("meme: invalid templates.json: " + err.Error())
+	}
+	byID := make(map[string]Template, len(list))
+	for _, t := range list {
+		byID[t.ID] = t
+	}
+	return byID
+}
+
+// Templates lists the template catalog by ID.
+func Templates() []Template {
+	list := make([]Template, 0, len(templates))
+	for _, t := range templates {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func TemplateByID(id string) (Template, bool) {
+	t, ok := templates[id]
+	return t, ok
+}
+
+// FetchTemplates reports whether template images missing from the assets are
+// fetched from their URL, which MEME_TEMPLATE_FETCH=true turns on.
+func FetchTemplates() bool {
+	fetch, _ := strconv.ParseBool(os.Getenv("MEME_TEMPLATE_FETCH"))
+	return fetch
+}
+
+// templateImage loads the template image from the assets, falling back to its
+// URL if FetchTemplates. Fetched images are kept for later renders.
+func templateImage(ctx context.Context, t Template) (image.Image, error) {
+	img, err := assets.Image(t.Asset())
+	if err == nil {
+		return img, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if !FetchTemplates() {
+		return nil, fmt.Errorf("template %s has no image: add %s to JASPER_ASSETS_DIR or set MEME_TEMPLATE_FETCH=true", t.ID, t.Asset())
+	}
+
+	if cached, ok := templateImages.Load(t.ID); ok {
+		return cached.(image.Image), nil
+	}
+	img, err = fetch.Image(ctx, t.URL)
+	if err != nil {
+		return nil, err
+	}
+	templateImages.Store(t.ID, img)
+	return img, nil
+}
+
+// GenTemplate renders texts into the boxes of the template, in order. Empty
+// texts leave their box blank. opts apply on top of each box's own style.
+func GenTemplate(ctx context.Context, id string, texts []string, opts textlayout.StyleOptions) (image.Image, error) {
+	ctx, span := tracing.Start(ctx, "meme.GenTemplate", attribute.String("meme.template", id))
+	defer span.End()
+
+	t, ok := TemplateByID(id)
+	if !ok {
+		return nil, tracing.RecordError(span, fmt.Errorf("unknown template %q", id))
+	}
+	if len(texts) > len(t.Boxes) {
+		return nil, tracing.RecordError(span, fmt.Errorf("template %s takes at most %d texts", id, len(t.Boxes)))
+	}
+
+	img, err := templateImage(ctx, t)
+	if err != nil {
+		slog.Error("Failed to load template image", "template", id, "error", err)
+		return nil, tracing.RecordError(span, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+
+	_, renderSpan := tracing.Start(ctx, "meme.render")
+	defer renderSpan.End()
+
+	w, h := float64(img.Bounds().Dx()), float64(img.Bounds().Dy())
+	dc := gg.NewContext(int(w), int(h))
+	dc.DrawImage(img, 0, 0)
+
+	for i, text := range texts {
+		if text == "" {
+			continue
+		}
+		if err := drawBox(dc, t.Boxes[i], text, w, h, opts); err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+	}
+	return dc.Image(), nil
+}
+
+// style is the Impact style in the box's colors, outlined only if the box has
+// an outline color.
+func (b Box) style() (textlayout.Style, error) {
+	return textlayout.Impact.With(textlayout.StyleOptions{Fill: b.Color, Stroke: cmp.Or(b.Outline, "none")})
+}
+
+func drawBox(dc *gg.Context, box Box, text string, imgWidth, imgHeight float64, opts textlayout.StyleOptions) error {
+	style, err := box.style()
+	if err != nil {
+		return fmt.Errorf("box %s: %w", box.Label, err)
+	}
+	if style, err = style.With(opts); err != nil {
+		return err
+	}
+
+	bx, by := box.X*imgWidth, box.Y*imgHeight
+	bw, bh := box.Width*imgWidth, box.Height*imgHeight
+	pad := min(bw, bh) * boxPadding
+	bx, by, bw, bh = bx+pad, by+pad, bw-2*pad, bh-2*pad
+
+	fitted, err := textlayout.Fit(fonts.Impact, text, minTemplateFontSize, box.MaxFontSize*imgWidth/500, lineHeight, bw, bh)
+	if err != nil {
+		return err
+	}
+	size, lines := fitted.Size, fitted.Lines
+
+	dc.Push()
+	defer dc.Pop()
+	if box.Rotation != 0 {
+		dc.RotateAbout(gg.Radians(box.Rotation), bx+bw/2, by+bh/2)
+	}
+
+	lineHeightPx := size * lineHeight
+	y := by + bh/2 - float64(len(lines))*lineHeightPx/2 + size
+	for _, line := range lines {
+		// Right-to-left lines start at the other side of the box. Each line
+		// takes its own direction, as when it is reordered.
+		align := box.Align
+		if textlayout.RTL(line) {
+			switch align {
+			case "left":
+				align = "right"
+			case "right":
+				align = "left"
+			}
+		}
+		lw := textlayout.Measure(fitted.Face, line)
+		x := bx + (bw-lw)/2
+		switch align {
+		case "left":
+			x = bx
+		case "right":
+			x = bx + bw - lw
+		}
+		style.DrawString(dc, fitted.Face, line, x, y)
+		y += lineHeightPx
+	}
+	return nil
+}
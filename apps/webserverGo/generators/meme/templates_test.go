@@ -0,0 +1,223 @@
+package meme
+
+import (
+	"context"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/gg"
+
+	"jasper/assets"
+	"jasper/golden"
+	"jasper/textlayout"
+)
+
+// inkSpan returns the leftmost and rightmost columns of img with dark pixels.
+func inkSpan(img image.Image) (int, int) {
+	b := img.Bounds()
+	left, right := b.Max.X, b.Min.X-1
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r < 0x8000 {
+				left, right = min(left, x), max(right, x)
+			}
+		}
+	}
+	return left, right
+}
+
+func TestBoxAlignmentFollowsDirection(t *testing.T) {
+	tests := []struct {
+		name  string
+		align string
+		text  string
+		// side is where the text should sit in the box.
+		side string
+	}{
+		{"ltr left", "left", "hi there", "left"},
+		{"ltr right", "right", "hi there", "right"},
+		{"rtl left", "left", "שלום", "right"},
+		{"rtl right", "right", "שלום", "left"},
+		{"arabic left", "left", "مرحبا", "right"},
+		{"rtl with number left", "left", "מחיר 100", "right"},
+		{"ltr with rtl word left", "left", "hi שלום", "left"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const w, h = 600, 120
+			dc := gg.NewContext(w, h)
+			dc.SetRGB(1, 1, 1)
+			dc.Clear()
+			box := Box{X: 0, Y: 0, Width: 1, Height: 1, Align: tt.align, MaxFontSize: 40, Color: "#000000"}
+			if err := drawBox(dc, box, tt.text, w, h, textlayout.StyleOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			left, right := inkSpan(dc.Image())
+			if right < left {
+				t.Fatal("nothing was drawn")
+			}
+			center := (left + right) / 2
+			if tt.side == "left" && center > w/2 || tt.side == "right" && center < w/2 {
+				t.Errorf("text spans %d..%d, want it on the %s", left, right, tt.side)
+			}
+		})
+	}
+}
+
+func TestTemplateImageIsNotFetchedByDefault(t *testing.T) {
+	dir := t.TempDir()
+	assets.SetOverrideDir(dir)
+	t.Cleanup(func() { assets.SetOverrideDir("") })
+	t.Setenv("MEME_TEMPLATE_FETCH", "")
+
+	tmpl := Template{ID: "test", URL: "http://127.0.0.1:0/unreachable.jpg"}
+	_, err := templateImage(context.Background(), tmpl)
+	if err == nil || !strings.Contains(err.Error(), "MEME_TEMPLATE_FETCH") {
+		t.Fatalf("templateImage without an asset = %v, want it not to fetch", err)
+	}
+
+	writeTemplateImage(t, dir, tmpl, gg.NewContext(40, 30))
+	img, err := templateImage(context.Background(), tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 40 || b.Dy() != 30 {
+		t.Errorf("template image is %v, want the 40x30 asset", b)
+	}
+}
+
+// writeTemplateImage saves the image of dc as the asset of the template in
+// the override directory dir.
+func writeTemplateImage(t *testing.T, dir string, tmpl Template, dc *gg.Context) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(tmpl.Asset()))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.SavePNG(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// hasInk reports whether img has dark pixels within r.
+func hasInk(img image.Image, r image.Rectangle) bool {
+	r = r.Intersect(img.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if c, _, _, _ := img.At(x, y).RGBA(); c < 0x8000 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestTemplatesAreValid(t *testing.T) {
+	list := Templates()
+	if len(list) == 0 {
+		t.Fatal("no templates")
+	}
+	for _, tmpl := range list {
+		if tmpl.Name == "" || tmpl.URL == "" || len(tmpl.Boxes) == 0 {
+			t.Errorf("template %q is missing a name, URL or boxes", tmpl.ID)
+		}
+		for _, box := range tmpl.Boxes {
+			if box.X < 0 || box.Y < 0 || box.Width <= 0 || box.Height <= 0 || box.X+box.Width > 1 || box.Y+box.Height > 1 {
+				t.Errorf("template %s: box %q is outside the image", tmpl.ID, box.Label)
+			}
+			switch box.Align {
+			case "left", "center", "right":
+			default:
+				t.Errorf("template %s: box %q has align %q", tmpl.ID, box.Label, box.Align)
+			}
+			if box.MaxFontSize <= 0 {
+				t.Errorf("template %s: box %q has no font size", tmpl.ID, box.Label)
+			}
+			if _, err := box.style(); err != nil {
+				t.Errorf("template %s: box %q: %v", tmpl.ID, box.Label, err)
+			}
+		}
+	}
+}
+
+func TestGenTemplateFillsBoxesInOrder(t *testing.T) {
+	dir := t.TempDir()
+	assets.SetOverrideDir(dir)
+	t.Cleanup(func() { assets.SetOverrideDir("") })
+
+	const w, h = 500, 500
+	tmpl, _ := TemplateByID("drake")
+	dc := gg.NewContext(w, h)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+	writeTemplateImage(t, dir, tmpl, dc)
+
+	boxRect := func(b Box) image.Rectangle {
+		return image.Rect(int(b.X*w), int(b.Y*h), int((b.X+b.Width)*w), int((b.Y+b.Height)*h))
+	}
+	tests := []struct {
+		texts []string
+		// inked says which boxes should have text in them.
+		inked []bool
+	}{
+		{[]string{"nope"}, []bool{true, false}},
+		{[]string{"", "yes"}, []bool{false, true}},
+		{[]string{"nope", "yes"}, []bool{true, true}},
+	}
+	for _, tt := range tests {
+		img, err := GenTemplate(context.Background(), tmpl.ID, tt.texts, textlayout.StyleOptions{})
+		if err != nil {
+			t.Fatalf("GenTemplate(%q): %v", tt.texts, err)
+		}
+		if b := img.Bounds(); b.Dx() != w || b.Dy() != h {
+			t.Errorf("GenTemplate(%q) is %v, want the %dx%d template", tt.texts, b, w, h)
+		}
+		for i, box := range tmpl.Boxes {
+			if got := hasInk(img, boxRect(box)); got != tt.inked[i] {
+				t.Errorf("GenTemplate(%q): box %q has text = %v, want %v", tt.texts, box.Label, got, tt.inked[i])
+			}
+		}
+		if hasInk(img, image.Rect(0, 0, w/2, h)) {
+			t.Errorf("GenTemplate(%q) drew outside the boxes", tt.texts)
+		}
+	}
+}
+
+func TestGenTemplateRejectsBadRequests(t *testing.T) {
+	tests := []struct {
+		id    string
+		texts []string
+		want  string
+	}{
+		{"no-such-template", []string{"hi"}, "unknown template"},
+		{"drake", []string{"a", "b", "c"}, "at most 2 texts"},
+	}
+	for _, tt := range tests {
+		_, err := GenTemplate(context.Background(), tt.id, tt.texts, textlayout.StyleOptions{})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("GenTemplate(%q, %q) = %v, want an error containing %q", tt.id, tt.texts, err, tt.want)
+		}
+	}
+}
+
+func TestBoxMixedDirectionGolden(t *testing.T) {
+	const w, h = 600, 720
+	dc := gg.NewContext(w, h)
+	dc.SetRGB(0.85, 0.85, 0.85)
+	dc.Clear()
+	for i, line := range mixedLines {
+		box := Box{X: 0.02, Y: float64(i) / 6, Width: 0.96, Height: 1.0 / 6, Align: "left", MaxFontSize: 36, Color: "#ffffff", Outline: "#000000"}
+		if err := drawBox(dc, box, line, w, h, textlayout.StyleOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Each line of a box is aligned by its own direction.
+	box := Box{X: 0.02, Y: 4.0 / 6, Width: 0.96, Height: 2.0 / 6, Align: "left", MaxFontSize: 36, Color: "#ffffff", Outline: "#000000"}
+	if err := drawBox(dc, box, mixedLines[0]+"\n"+mixedLines[1], w, h, textlayout.StyleOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	golden.Assert(t, "bidi-boxes", dc.Image())
+}
@@ -0,0 +1,453 @@
+package skullboard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log/slog"
+	"mime"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/image/font"
+
+	"jasper/fonts"
+	"jasper/textlayout"
+	"jasper/tracing"
+	"jasper/utils"
+)
+
+// Attachment follows the shape of Discord's attachment objects. Spoiler is
+// also set for files named SPOILER_*, as Discord marks them.
+type Attachment struct {
+	URL         string `json:"url"`
+	ProxyURL    string `json:"proxy_url,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Spoiler     bool   `json:"spoiler,omitempty"`
+}
+
+// UnmarshalJSON also accepts a plain URL string, which is treated as an image.
+func (a *Attachment) UnmarshalJSON(data []byte) error {
+	var rawURL string
+	if err := json.Unmarshal(data, &rawURL); err == nil {
+		*a = Attachment{URL: rawURL}
+		return nil
+	}
+
+	type plain Attachment
+	return json.Unmarshal(data, (*plain)(a))
+}
+
+type AttachmentKind int
+
+const (
+	AttachmentImage AttachmentKind = iota
+	AttachmentVideo
+	AttachmentFile
+)
+
+// Kind classifies the attachment by content type, falling back to the file
+// extension. Attachments with neither are assumed to be images.
+func (a Attachment) Kind() AttachmentKind {
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(strings.ToLower(path.Ext(a.name())))
+	}
+	switch {
+	case contentType == "" && a.Filename == "":
+		return AttachmentImage
+	case strings.HasPrefix(contentType, "image/"):
+		return AttachmentImage
+	case strings.HasPrefix(contentType, "video/"):
+		return AttachmentVideo
+	}
+	return AttachmentFile
+}
+
+func (a Attachment) IsSpoiler() bool {
+	return a.Spoiler || strings.HasPrefix(a.Filename, "SPOILER_")
+}
+
+func (a Attachment) name() string {
+	if a.Filename != "" {
+		return a.Filename
+	}
+	if u, err := url.Parse(a.URL); err == nil {
+		return path.Base(u.Path)
+	}
+	return a.URL
+}
+
+// imageURL is the image drawn for a media attachment: the image itself, or
+// the poster of a video.
+func (a Attachment) imageURL() string {
+	if a.Kind() == AttachmentVideo {
+		return a.posterURL()
+	}
+	return a.URL
+}
+
+// posterURL asks Discord's media proxy for the first frame of a video. Only
+// the proxy renders posters, so CDN links are pointed at it and videos hosted
+// elsewhere have no poster and are drawn as placeholders.
+func (a Attachment) posterURL() string {
+	base := a.ProxyURL
+	if base == "" {
+		base = a.URL
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	switch u.Host {
+	case mediaProxyHost:
+	case cdnHost:
+		u.Host = mediaProxyHost
+	default:
+		return ""
+	}
+	q := u.Query()
+	q.Set("format", "webp")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+const (
+	cdnHost        = "cdn.discordapp.com"
+	mediaProxyHost = "media.discordapp.net"
+)
+
+const (
+	mosaicMaxWidth  = 550
+	singleMaxHeight = 350
+	mosaicGap       = 4
+	mediaRadius     = 8
+	playGlyphRadius = 24
+	// A single attachment that failed to load takes this size.
+	failedMediaWidth  = 400
+	failedMediaHeight = 225
+	spoilerMedia      = 12
+
+	fileCardWidth  = 432
+	fileCardHeight = 66
+	fileIconWidth  = 30
+	fileIconHeight = 40
+	fileCardGap    = 8
+)
+
+// maxMosaicMedia is the most attachments Discord puts in one mosaic. Further
+// media is listed as files.
+const maxMosaicMedia = 10
+
+// mosaicRows is how Discord arranges 1 to 10 media attachments: the number of
+// cells in each row. Three attachments are a special case with one large cell
+// on the left.
+var mosaicRows = map[int][]int{
+	1:  {1},
+	2:  {2},
+	4:  {2, 2},
+	5:  {2, 3},
+	6:  {3, 3},
+	7:  {1, 3, 3},
+	8:  {2, 3, 3},
+	9:  {3, 3, 3},
+	10: {1, 3, 3, 3},
+}
+
+type mediaCell struct {
+	img        image.Image
+	x, y, w, h float64
+	video      bool
+	spoiler    bool
+	// noPoster is set for a video without a poster to load, which is drawn
+	// as an empty player rather than as failed media.
+	noPoster bool
+}
+
+type fileCard struct {
+	name, size string
+	spoiler    bool
+}
+
+type attachmentsLayout struct {
+	theme  Theme
+	face   font.Face
+	small  font.Face
+	cells  []mediaCell
+	files  []fileCard
+	mosaic float64
+	height float64
+}
+
+func layoutAttachments(ctx context.Context, attachments []Attachment, theme Theme, maxWidth float64) (attachmentsLayout, error) {
+	ctx, span := tracing.Start(ctx, "skullboard.attachments", attribute.Int("skullboard.attachments", len(attachments)))
+	defer span.End()
+
+	layout := attachmentsLayout{theme: theme}
+	var media []mediaCell
+	for _, attachment := range attachments {
+		kind := attachment.Kind()
+		if kind == AttachmentFile || len(media) == maxMosaicMedia {
+			layout.files = append(layout.files, fileCard{name: attachment.name(), size: formatSize(attachment.Size), spoiler: attachment.IsSpoiler()})
+			continue
+		}
+
+		// A nil image is drawn as a placeholder rather than failing the message.
+		imageURL := attachment.imageURL()
+		img := loadOptionalImage(ctx, "attachment", imageURL)
+		media = append(media, mediaCell{img: img, video: kind == AttachmentVideo, spoiler: attachment.IsSpoiler(), noPoster: imageURL == ""})
+	}
+
+	if len(media) > 0 {
+		layout.cells, layout.mosaic = arrangeMosaic(media, min(maxWidth, mosaicMaxWidth))
+		layout.height = layout.mosaic
+	}
+
+	if len(layout.files) > 0 {
+		var err error
+		if layout.face, err = fonts.Face(fonts.Discord, fontSize); err != nil {
+			return attachmentsLayout{}, tracing.RecordError(span, err)
+		}
+		if layout.small, err = fonts.Face(fonts.Discord, 12); err != nil {
+			return attachmentsLayout{}, tracing.RecordError(span, err)
+		}
+		if layout.height > 0 {
+			layout.height += fileCardGap
+		}
+		layout.height += float64(len(layout.files))*(fileCardHeight+fileCardGap) - fileCardGap
+	}
+	return layout, nil
+}
+
+// arrangeMosaic positions the cells and returns them with the total height. A
+// single image keeps its aspect ratio, while cells of a mosaic are cropped.
+func arrangeMosaic(cells []mediaCell, width float64) ([]mediaCell, float64) {
+	switch len(cells) {
+	case 1:
+		b := image.Rect(0, 0, failedMediaWidth, failedMediaHeight)
+		if cells[0].img != nil {
+			b = cells[0].img.Bounds()
+		}
+		cells[0].w, cells[0].h = fitSize(float64(b.Dx()), float64(b.Dy()), width, singleMaxHeight)
+		return cells, cells[0].h
+	case 3:
+		big := (width - mosaicGap) * 2 / 3
+		small := width - mosaicGap - big
+		half := (big - mosaicGap) / 2
+		cells[0].w, cells[0].h = big, big
+		cells[1].x, cells[1].w, cells[1].h = big+mosaicGap, small, half
+		cells[2].x, cells[2].y, cells[2].w, cells[2].h = big+mosaicGap, half+mosaicGap, small, half
+		return cells, big
+	}
+
+	y, i := 0.0, 0
+	for _, count := range mosaicRows[len(cells)] {
+		w := (width - mosaicGap*float64(count-1)) / float64(count)
+		h := w
+		if count == 1 {
+			h = width / 2
+		}
+		for col := 0; col < count; col++ {
+			cells[i].x, cells[i].y, cells[i].w, cells[i].h = float64(col)*(w+mosaicGap), y, w, h
+			i++
+		}
+		y += h + mosaicGap
+	}
+	return cells, y - mosaicGap
+}
+
+func (a attachmentsLayout) draw(ctx context.Context, dc *gg.Context, x, y float64) {
+	for _, cell := range a.cells {
+		cell.draw(dc, a.theme, x+cell.x, y+cell.y)
+	}
+
+	cardY := y + a.mosaic
+	if a.mosaic > 0 {
+		cardY += fileCardGap
+	}
+	for _, file := range a.files {
+		a.drawFileCard(dc, file, x, cardY)
+		cardY += fileCardHeight + fileCardGap
+	}
+}
+
+func (c mediaCell) draw(dc *gg.Context, theme Theme, x, y float64) {
+	if c.img == nil && c.video && c.noPoster {
+		dc.SetColor(color.Black)
+		dc.DrawRoundedRectangle(x, y, c.w, c.h, mediaRadius)
+		dc.Fill()
+		drawPlayGlyph(dc, x+c.w/2, y+c.h/2)
+		return
+	}
+	if c.img == nil {
+		drawFailedMedia(dc, theme, x, y, c.w, c.h)
+		return
+	}
+
+	img := utils.ResizeImageToFill(c.img, int(c.w), int(c.h))
+	if c.spoiler {
+		// Blur before clipping, so the corners stay round.
+		rgba := image.NewRGBA(img.Bounds())
+		draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+		blurRect(rgba, rgba.Bounds(), spoilerMedia)
+		img = rgba
+	}
+	dc.DrawRoundedRectangle(x, y, c.w, c.h, mediaRadius)
+	dc.Clip()
+	dc.DrawImage(img, int(x), int(y))
+	dc.ResetClip()
+
+	if c.spoiler {
+		drawLabel(dc, "SPOILER", x+c.w/2, y+c.h/2)
+		return
+	}
+
+	if c.video {
+		drawPlayGlyph(dc, x+c.w/2, y+c.h/2)
+	}
+}
+
+// drawPlayGlyph draws a video's play button centred at (cx, cy).
+func drawPlayGlyph(dc *gg.Context, cx, cy float64) {
+	dc.SetColor(color.NRGBA{A: 150})
+	dc.DrawCircle(cx, cy, playGlyphRadius)
+	dc.Fill()
+	dc.SetColor(color.White)
+	r := playGlyphRadius * 0.45
+	dc.MoveTo(cx-r*0.6, cy-r)
+	dc.LineTo(cx+r, cy)
+	dc.LineTo(cx-r*0.6, cy+r)
+	dc.ClosePath()
+	dc.Fill()
+}
+
+// drawFailedMedia draws the placeholder of media that failed to load.
+func drawFailedMedia(dc *gg.Context, theme Theme, x, y, w, h float64) {
+	dc.SetColor(theme.EmbedBackground)
+	dc.DrawRoundedRectangle(x, y, w, h, mediaRadius)
+	dc.FillPreserve()
+	dc.SetColor(theme.CodeBorder)
+	dc.SetLineWidth(1)
+	dc.Stroke()
+
+	face, err := fonts.Face(fonts.Discord, 14)
+	if err != nil {
+		slog.Error("Failed to load font", "family", fonts.Discord, "error", err)
+		return
+	}
+	drawImageGlyph(dc, x+(w-replyIconWidth)/2, y+h/2-replyIconHeight-4, theme.Muted)
+	dc.SetFontFace(face)
+	dc.SetColor(theme.Muted)
+	dc.DrawStringAnchored(ellipsize(face, "Failed to load", w-8), x+w/2, y+h/2+4, 0.5, 0.8)
+}
+
+// drawLabel draws white bold text on a dark pill centred at (cx, cy).
+func drawLabel(dc *gg.Context, text string, cx, cy float64) {
+	face, err := fonts.Face(fonts.DiscordBold, 14)
+	if err != nil {
+		slog.Error("Failed to load font", "family", fonts.DiscordBold, "error", err)
+		return
+	}
+	dc.SetFontFace(face)
+	w, h := dc.MeasureString(text)
+	dc.SetColor(color.NRGBA{A: 153})
+	dc.DrawRoundedRectangle(cx-w/2-12, cy-h/2-8, w+24, h+16, (h+16)/2)
+	dc.Fill()
+	dc.SetColor(color.White)
+	dc.DrawStringAnchored(text, cx, cy, 0.5, 0.35)
+}
+
+func (a attachmentsLayout) drawFileCard(dc *gg.Context, file fileCard, x, y float64) {
+	dc.SetColor(a.theme.EmbedBackground)
+	dc.DrawRoundedRectangle(x, y, fileCardWidth, fileCardHeight, mediaRadius)
+	dc.FillPreserve()
+	dc.SetColor(a.theme.CodeBorder)
+	dc.SetLineWidth(1)
+	dc.Stroke()
+
+	drawFileIcon(dc, x+16, y+(fileCardHeight-fileIconHeight)/2, a.theme.Link)
+
+	textX := x + 16 + fileIconWidth + 12
+	textWidth := fileCardWidth - (textX - x) - 16
+	name := file.name
+	if file.spoiler {
+		name = "SPOILER"
+	}
+	name = ellipsize(a.face, name, textWidth)
+	if file.size == "" {
+		// Without a size line the name is centred in the card.
+		textlayout.DrawStringAnchored(dc, a.face, a.theme.Link, name, textX, y+fileCardHeight/2, 0, 0.35)
+		return
+	}
+	textlayout.DrawStringAnchored(dc, a.face, a.theme.Link, name, textX, y+fileCardHeight/2, 0, 0)
+	dc.SetFontFace(a.small)
+	dc.SetColor(a.theme.Muted)
+	dc.DrawString(file.size, textX, y+fileCardHeight/2+16)
+}
+
+// drawFileIcon draws a page with a folded corner, the generic file icon.
+func drawFileIcon(dc *gg.Context, x, y float64, accent color.Color) {
+	fold := 10.0
+	dc.MoveTo(x, y)
+	dc.LineTo(x+fileIconWidth-fold, y)
+	dc.LineTo(x+fileIconWidth, y+fold)
+	dc.LineTo(x+fileIconWidth, y+fileIconHeight)
+	dc.LineTo(x, y+fileIconHeight)
+	dc.ClosePath()
+	dc.SetColor(accent)
+	dc.Fill()
+
+	dc.MoveTo(x+fileIconWidth-fold, y)
+	dc.LineTo(x+fileIconWidth-fold, y+fold)
+	dc.LineTo(x+fileIconWidth, y+fold)
+	dc.ClosePath()
+	dc.SetColor(color.NRGBA{R: 255, G: 255, B: 255, A: 120})
+	dc.Fill()
+}
+
+// ellipsize shortens s with a trailing ellipsis until it fits maxWidth.
+func ellipsize(face font.Face, s string, maxWidth float64) string {
+	if measure(face, s) <= maxWidth {
+		return s
+	}
+	runes := []rune(s)
+	// Visible glyphs are at least a pixel wide, so no more runes than that
+	// fit, and the search measures short prefixes only.
+	runes = runes[:min(len(runes), int(maxWidth)+1)]
+	candidate := func(n int) string {
+		return strings.TrimRight(string(runes[:n]), " ") + "…"
+	}
+	n := sort.Search(len(runes)+1, func(n int) bool {
+		return measure(face, candidate(n)) > maxWidth
+	})
+	if n == 0 {
+		return "…"
+	}
+	return candidate(n - 1)
+}
+
+// formatSize formats a file size for a file card, or is empty if it is unknown.
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes <= 0 {
+		return ""
+	}
+	if bytes < unit {
+		return fmt.Sprintf("%d bytes", bytes)
+	}
+	value, exp := float64(bytes)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %s", value, []string{"KB", "MB", "GB", "TB"}[exp])
+}
@@ -0,0 +1,80 @@
+package skullboard
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"jasper/assets"
+)
+
+func TestEllipsize(t *testing.T) {
+	face, err := assets.Face(assets.FontGGSans, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ellipsize(face, "short.txt", 200); got != "short.txt" {
+		t.Errorf("ellipsize of fitting text = %q", got)
+	}
+
+	long := strings.Repeat("abcdefgh ", 40)
+	got := ellipsize(face, long, 200)
+	if !strings.HasSuffix(got, "…") || !strings.HasPrefix(long, strings.TrimSuffix(got, "…")) {
+		t.Fatalf("ellipsize = %q, want a prefix with an ellipsis", got)
+	}
+	if w := measure(face, got); w > 200 {
+		t.Errorf("ellipsized text is %v wide, want at most 200", w)
+	}
+	// One more rune would not fit.
+	next := []rune(long)[len([]rune(got))-1 : len([]rune(got))]
+	if w := measure(face, strings.TrimSuffix(got, "…")+string(next)+"…"); w <= 200 && next[0] != ' ' {
+		t.Errorf("ellipsize cut %q short", got)
+	}
+
+	if got := ellipsize(face, "wide", 1); got != "…" {
+		t.Errorf("ellipsize into no space = %q, want just the ellipsis", got)
+	}
+
+	start := time.Now()
+	ellipsize(face, strings.Repeat("x", 1<<20), 300)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("ellipsize of a 1 MiB name took %v", d)
+	}
+}
+
+func TestPosterURL(t *testing.T) {
+	tests := []struct {
+		attachment Attachment
+		want       string
+	}{
+		{
+			Attachment{URL: "https://cdn.discordapp.com/attachments/1/2/clip.mp4", ProxyURL: "https://media.discordapp.net/attachments/1/2/clip.mp4"},
+			"https://media.discordapp.net/attachments/1/2/clip.mp4?format=webp",
+		},
+		{
+			Attachment{URL: "https://cdn.discordapp.com/attachments/1/2/clip.mp4?ex=1&hm=2"},
+			"https://media.discordapp.net/attachments/1/2/clip.mp4?ex=1&format=webp&hm=2",
+		},
+		{Attachment{URL: "https://example.com/clip.mp4"}, ""},
+		{Attachment{URL: "::not a url"}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.attachment.posterURL(); got != tt.want {
+			t.Errorf("posterURL(%q) = %q, want %q", tt.attachment.URL, got, tt.want)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		0:       "",
+		512:     "512 bytes",
+		2048:    "2.00 KB",
+		5 << 20: "5.00 MB",
+	}
+	for size, want := range tests {
+		if got := formatSize(size); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", size, got, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package skullboard
+
+import (
+	"context"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"log/slog"
+	"strconv"
+
+	"github.com/fogleman/gg"
+
+	"jasper/fetch"
+	"jasper/warnings"
+)
+
+// defaultAvatarColors are the backgrounds of Discord's six default avatars.
+var defaultAvatarColors = []color.RGBA{
+	{R: 88, G: 101, B: 242, A: 255},
+	{R: 117, G: 126, B: 138, A: 255},
+	{R: 59, G: 165, B: 92, A: 255},
+	{R: 250, G: 166, B: 26, A: 255},
+	{R: 237, G: 66, B: 69, A: 255},
+	{R: 235, G: 69, B: 159, A: 255},
+}
+
+const defaultAvatarSize = 128
+
+// loadAvatar fetches an avatar, falling back to the default avatar for key
+// when there is no URL or it fails to load.
+func loadAvatar(ctx context.Context, what, rawURL, key string) image.Image {
+	if rawURL == "" {
+		return defaultAvatar(key)
+	}
+	img, err := fetch.Image(ctx, rawURL)
+	if err != nil {
+		slog.Warn("Failed to load avatar, using the default avatar", "element", what, "url", rawURL, "error", err)
+		warnings.Add(ctx, "%s %s failed to load, using the default avatar", what, rawURL)
+		return defaultAvatar(key)
+	}
+	return img
+}
+
+// defaultAvatar draws the avatar Discord shows for users without one. For a
+// user ID the color is picked like the client does, (id >> 22) % 6; any other
+// key is hashed so the same user always gets the same color.
+func defaultAvatar(key string) image.Image {
+	var index uint64
+	if id, err := strconv.ParseUint(key, 10, 64); err == nil {
+		index = (id >> 22) % uint64(len(defaultAvatarColors))
+	} else {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		index = uint64(h.Sum32()) % uint64(len(defaultAvatarColors))
+	}
+	background := defaultAvatarColors[index]
+
+	const s = defaultAvatarSize
+	dc := gg.NewContext(s, s)
+	dc.SetColor(background)
+	dc.Clear()
+
+	// A simplified Clyde: a rounded head with two eyes.
+	dc.SetColor(color.White)
+	dc.DrawRoundedRectangle(s*0.22, s*0.3, s*0.56, s*0.4, s*0.16)
+	dc.Fill()
+	dc.DrawCircle(s*0.3, s*0.34, s*0.08)
+	dc.DrawCircle(s*0.7, s*0.34, s*0.08)
+	dc.Fill()
+	dc.SetColor(background)
+	dc.DrawEllipse(s*0.4, s*0.5, s*0.055, s*0.07)
+	dc.DrawEllipse(s*0.6, s*0.5, s*0.055, s*0.07)
+	dc.Fill()
+	return dc.Image()
+}
@@ -0,0 +1,665 @@
+package skullboard
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"log/slog"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+
+	"jasper/assets"
+	"jasper/emoji"
+	"jasper/fetch"
+	"jasper/fonts"
+	"jasper/markdown"
+	"jasper/textlayout"
+	"jasper/tracing"
+	"jasper/utils"
+	"jasper/warnings"
+)
+
+const (
+	emojiSize      = 22
+	jumboEmojiSize = 48
+	// Discord stops enlarging emoji-only messages past this many emoji.
+	maxJumboEmoji = 30
+	emojiSpacing  = 2
+
+	codeFontSize   = 14
+	codeBlockPad   = 8
+	codeBlockGap   = 4
+	subtextSize    = 13
+	headingGap     = 8
+	quoteBarWidth  = 4
+	quoteIndent    = quoteBarWidth + 12
+	inlineCodePadX = 3
+	pillPadX       = 2
+)
+
+var headingSizes = map[int]float64{1: 24, 2: 20, 3: 16}
+
+type inlineKind int
+
+const (
+	inlineText inlineKind = iota
+	inlineSpace
+	inlineEmoji
+)
+
+// inline is an unbreakable piece of a content line: a word, the space between
+// two words or an emoji.
+type inline struct {
+	kind  inlineKind
+	text  string
+	color color.Color
+	style markdown.Style
+	face  font.Face
+	width float64
+	emoji emoji.Token
+	// size is the font size of text, or the box size of an emoji.
+	size float64
+	// pill is the background of a mention, with the text inset from its edges.
+	pill  color.Color
+	inset float64
+	// breakAfter allows a line break between this text and the text after
+	// it, as between two Chinese characters or after a hyphen.
+	breakAfter bool
+}
+
+type contentLine struct {
+	items    []inline
+	height   float64
+	baseline float64
+}
+
+// contentBlock is a laid out markdown block. margin is the space above it and
+// pad the space inside a code block around its lines.
+type contentBlock struct {
+	kind   markdown.BlockKind
+	quote  bool
+	lines  []contentLine
+	margin float64
+	pad    float64
+	height float64
+}
+
+type contentLayout struct {
+	blocks    []contentBlock
+	theme     Theme
+	style     textStyle
+	emojiSize float64
+	width     float64
+	height    float64
+}
+
+// textStyle is the look of plain paragraphs in a piece of markdown. Headings,
+// subtext and code keep their own sizes.
+type textStyle struct {
+	size       float64
+	lineHeight float64
+	color      color.Color
+	extra      markdown.Style
+}
+
+func messageText(theme Theme) textStyle {
+	return textStyle{size: fontSize, lineHeight: lineHeight, color: theme.Text}
+}
+
+// segment is a run of message text with a single color, before it is split
+// into words. Mentions are a single segment with a pill background.
+type segment struct {
+	text  string
+	color color.Color
+	pill  color.Color
+}
+
+type familyKey struct {
+	family string
+	size   float64
+}
+
+// faceCache keeps the faces used by one layout, since every word looks one up.
+type faceCache map[familyKey]*fonts.MultiFace
+
+func (c faceCache) get(family string, size float64) (*fonts.MultiFace, error) {
+	key := familyKey{family: family, size: size}
+	if face, ok := c[key]; ok {
+		return face, nil
+	}
+	face, err := fonts.Face(family, size)
+	if err != nil {
+		return nil, err
+	}
+	c[key] = face
+	return face, nil
+}
+
+func familyFor(style markdown.Style) string {
+	switch {
+	case style.Has(markdown.Code):
+		return fonts.Mono
+	case style.Has(markdown.Bold) && style.Has(markdown.Italic):
+		return fonts.DiscordBoldItalic
+	case style.Has(markdown.Bold):
+		return fonts.DiscordBold
+	case style.Has(markdown.Italic):
+		return fonts.DiscordItalic
+	}
+	return fonts.Discord
+}
+
+func measure(face font.Face, s string) float64 {
+	return textlayout.Measure(face, s)
+}
+
+// layoutContent parses the message markdown and turns it into wrapped lines of
+// styled words and emoji. Messages made only of emoji get Discord's jumbo
+// emoji size.
+func layoutContent(ctx context.Context, data MessageData, maxWidth float64) (contentLayout, error) {
+	if strings.TrimSpace(data.Content) == "" {
+		return contentLayout{}, nil
+	}
+	theme := data.Theme.orDefault()
+	blocks := markdown.Parse(data.Content)
+	only, count := onlyEmoji(blocks)
+	return layoutBlocks(ctx, blocks, newMentionIndex(data.Mentions), theme, messageText(theme), maxWidth, only && count <= maxJumboEmoji)
+}
+
+// layoutText lays out text without parsing markdown, for places like embed
+// authors and footers where Discord shows it as is.
+func layoutText(ctx context.Context, text string, theme Theme, style textStyle, maxWidth float64) (contentLayout, error) {
+	blocks := []markdown.Block{{Kind: markdown.Paragraph, Spans: []markdown.Span{{Text: text}}}}
+	return layoutBlocks(ctx, blocks, nil, theme, style, maxWidth, false)
+}
+
+func layoutBlocks(ctx context.Context, blocks []markdown.Block, mentions mentionIndex, theme Theme, style textStyle, maxWidth float64, jumbo bool) (contentLayout, error) {
+	_, span := tracing.Start(ctx, "skullboard.WordWrap")
+	defer span.End()
+
+	layout := contentLayout{theme: theme, style: style, emojiSize: emojiSize, width: maxWidth}
+	if jumbo {
+		layout.emojiSize = jumboEmojiSize
+	}
+
+	faces := make(faceCache)
+	for i, block := range blocks {
+		laid, err := layout.layoutBlock(faces, block, mentions, i == 0)
+		if err != nil {
+			return contentLayout{}, tracing.RecordError(span, err)
+		}
+		layout.blocks = append(layout.blocks, laid)
+		layout.height += laid.height
+	}
+	return layout, nil
+}
+
+func onlyEmoji(blocks []markdown.Block) (bool, int) {
+	var text strings.Builder
+	for _, block := range blocks {
+		if block.Kind != markdown.Paragraph {
+			return false, 0
+		}
+		text.WriteString(markdown.PlainText(block.Spans))
+	}
+	return emoji.OnlyEmoji(emoji.Parse(text.String()))
+}
+
+func (c contentLayout) layoutBlock(faces faceCache, block markdown.Block, mentions mentionIndex, first bool) (contentBlock, error) {
+	laid := contentBlock{kind: block.Kind, quote: block.Quote}
+
+	maxWidth := c.width
+	if block.Quote {
+		maxWidth -= quoteIndent
+	}
+
+	size, base, extra := c.style.size, c.style.color, c.style.extra
+	lineH := c.style.lineHeight
+	switch block.Kind {
+	case markdown.Heading:
+		size, extra = headingSizes[block.Level], extra|markdown.Bold
+		lineH = size * 1.375
+		if !first {
+			laid.margin = headingGap
+		}
+	case markdown.Subtext:
+		size, base = subtextSize, c.theme.Muted
+		lineH = size * 1.4
+	case markdown.CodeBlock:
+		return c.layoutCode(faces, block, maxWidth, first)
+	}
+
+	regular, err := faces.get(fonts.Discord, size)
+	if err != nil {
+		return laid, err
+	}
+	metrics := regular.Metrics()
+	baselineIn := func(h float64) float64 {
+		return (h + float64(metrics.Ascent-metrics.Descent)/64) / 2
+	}
+
+	emojiBox := c.emojiSize * size / fontSize
+	heightOf := func(items []inline) float64 {
+		for _, item := range items {
+			if item.kind == inlineEmoji && c.emojiSize > emojiSize {
+				return c.emojiSize + 8
+			}
+		}
+		return lineH
+	}
+
+	var items []inline
+	for _, span := range block.Spans {
+		style := span.Style | extra
+		face, err := c.faceFor(faces, style, size)
+		if err != nil {
+			return laid, err
+		}
+		if style.Has(markdown.Code) {
+			// Mentions and emoji are not rendered inside inline code. Empty
+			// items on both sides pad the background without allowing a break.
+			pad := inline{kind: inlineText, style: style, face: face, size: size, width: inlineCodePadX}
+			items = append(items, pad)
+			items = appendWords(items, span.Text, face, base, style, size)
+			items = append(items, pad)
+			continue
+		}
+		for _, seg := range mentions.segments(span.Text, base, c.theme) {
+			if seg.pill != nil {
+				// Mentions never wrap, even when the name has spaces in it.
+				width := measure(face, seg.text) + pillPadX*2
+				items = append(items, inline{kind: inlineText, text: seg.text, color: seg.color, pill: seg.pill, inset: pillPadX, style: style, face: face, size: size, width: width})
+				continue
+			}
+			for _, token := range emoji.Parse(seg.text) {
+				if token.Kind != emoji.Text {
+					items = append(items, inline{kind: inlineEmoji, emoji: token, style: style, face: face, color: seg.color, size: emojiBox, width: emojiBox + emojiSpacing})
+					continue
+				}
+				items = appendWords(items, token.Text, face, seg.color, style, size)
+			}
+		}
+	}
+
+	laid.lines = wrapInlines(items, maxWidth, heightOf)
+	rtl := textlayout.RTL(blockText(block))
+	for i := range laid.lines {
+		laid.lines[i].items = visualOrder(laid.lines[i].items, rtl)
+		laid.lines[i].baseline = baselineIn(laid.lines[i].height)
+		laid.height += laid.lines[i].height
+	}
+	laid.height += laid.margin
+	return laid, nil
+}
+
+// layoutCode lays out a fenced code block: monospace text that keeps its
+// indentation, drawn on a full-width background.
+func (c contentLayout) layoutCode(faces faceCache, block markdown.Block, maxWidth float64, first bool) (contentBlock, error) {
+	laid := contentBlock{kind: block.Kind, quote: block.Quote, pad: codeBlockPad, margin: codeBlockGap}
+	if first {
+		laid.margin = 0
+	}
+
+	face, err := faces.get(fonts.Mono, codeFontSize)
+	if err != nil {
+		return laid, err
+	}
+	metrics := face.Metrics()
+	lineH := float64(codeFontSize) * 1.4
+	baseline := (lineH + float64(metrics.Ascent-metrics.Descent)/64) / 2
+	heightOf := func([]inline) float64 { return lineH }
+
+	code := strings.ReplaceAll(block.Code, "\t", "    ")
+	for _, hardLine := range strings.Split(code, "\n") {
+		items := appendWords(nil, hardLine, face, c.theme.Text, markdown.Code, codeFontSize)
+		for _, line := range wrapInlines(items, maxWidth-codeBlockPad*2, heightOf) {
+			line.baseline = baseline
+			laid.lines = append(laid.lines, line)
+			laid.height += line.height
+		}
+	}
+	laid.height += laid.margin + laid.pad*2
+	return laid, nil
+}
+
+func (c contentLayout) faceFor(faces faceCache, style markdown.Style, size float64) (font.Face, error) {
+	if style.Has(markdown.Code) {
+		// Inline code is drawn slightly smaller, like Discord's 85%.
+		size = float64(int(size*0.875 + 0.5))
+	}
+	return faces.get(familyFor(style), size)
+}
+
+func appendWords(items []inline, text string, face font.Face, c color.Color, style markdown.Style, size float64) []inline {
+	item := func(kind inlineKind, text string) inline {
+		return inline{kind: kind, text: text, color: c, style: style, face: face, size: size, width: measure(face, text)}
+	}
+
+	// Leading spaces are kept, for the indentation of code.
+	if word := strings.TrimLeft(text, " \t"); len(word) < len(text) {
+		items = append(items, item(inlineSpace, text[:len(text)-len(word)]))
+		text = word
+	}
+	segments := textlayout.Segments(text)
+	for i, segment := range segments {
+		word := segment.Word()
+		if word != "" {
+			text := item(inlineText, word)
+			// The end of the text is no break, since the next span may
+			// carry on the word in another style.
+			text.breakAfter = i < len(segments)-1 && word == segment.Text
+			items = append(items, text)
+		}
+		if spaces := segment.Text[len(word):]; spaces != "" {
+			items = append(items, item(inlineSpace, spaces))
+		}
+	}
+	return items
+}
+
+func blockText(block markdown.Block) string {
+	var b strings.Builder
+	for _, span := range block.Spans {
+		b.WriteString(span.Text)
+	}
+	return b.String()
+}
+
+// visualOrder puts the items of a line in display order, so right-to-left
+// words read from right to left. The line keeps its left alignment.
+func visualOrder(items []inline, rtl bool) []inline {
+	classes := make([]textlayout.Class, len(items))
+	mixed := rtl
+	for i, item := range items {
+		if item.kind == inlineText {
+			classes[i] = textlayout.ClassOf(item.text)
+			mixed = mixed || classes[i] == textlayout.RightToLeft
+		}
+	}
+	if !mixed {
+		return items
+	}
+	ordered := make([]inline, len(items))
+	for i, j := range textlayout.VisualOrder(classes, rtl) {
+		ordered[i] = items[j]
+	}
+	return ordered
+}
+
+// wrapInlines breaks items into lines no wider than maxWidth. Lines break at
+// spaces, around emoji and where text allows a break, so a word that changes
+// style halfway through, like **bo**ld, stays in one piece. A piece wider than
+// a line is broken between characters, without a hyphen as in the client.
+func wrapInlines(items []inline, maxWidth float64, heightOf func([]inline) float64) []contentLine {
+	var lines []contentLine
+	var current []inline
+	width := 0.0
+
+	flush := func() {
+		for len(current) > 0 && current[len(current)-1].kind == inlineSpace {
+			current = current[:len(current)-1]
+		}
+		lines = append(lines, contentLine{items: current, height: heightOf(current)})
+		current = nil
+		width = 0
+	}
+
+	for i := 0; i < len(items); {
+		item := items[i]
+		if item.kind == inlineSpace && len(current) == 0 && len(lines) > 0 {
+			i++
+			continue
+		}
+
+		end := i + 1
+		if item.kind == inlineText {
+			for end < len(items) && items[end].kind == inlineText && !items[end-1].breakAfter {
+				end++
+			}
+		}
+		w := 0.0
+		for _, part := range items[i:end] {
+			w += part.width
+		}
+
+		if width+w > maxWidth && len(current) > 0 && item.kind != inlineSpace {
+			flush()
+		}
+		if w > maxWidth && item.kind == inlineText {
+			for _, part := range items[i:end] {
+				if width+part.width > maxWidth && part.pill == nil && part.text != "" {
+					pieces := textlayout.Break(part.face, part.text, maxWidth-width, maxWidth, false)
+					for j, piece := range pieces {
+						if j > 0 {
+							flush()
+						}
+						if piece == "" {
+							continue
+						}
+						part.text, part.width = piece, measure(part.face, piece)
+						current = append(current, part)
+						width += part.width
+					}
+					continue
+				}
+				if width+part.width > maxWidth && len(current) > 0 {
+					flush()
+				}
+				current = append(current, part)
+				width += part.width
+			}
+			i = end
+			continue
+		}
+		current = append(current, items[i:end]...)
+		width += w
+		i = end
+	}
+	flush()
+	return lines
+}
+
+// draw renders the content with its top left corner at (x, y).
+func (c contentLayout) draw(ctx context.Context, dc *gg.Context, x, y float64) {
+	ctx, span := tracing.Start(ctx, "skullboard.content.draw")
+	defer span.End()
+
+	for _, block := range c.blocks {
+		y += block.margin
+		bx, width := x, c.width
+		if block.quote {
+			dc.SetColor(c.theme.QuoteBar)
+			// Plain rectangles so consecutive quoted lines join into one bar.
+			dc.DrawRectangle(x, y, quoteBarWidth, block.height-block.margin)
+			dc.Fill()
+			bx += quoteIndent
+			width -= quoteIndent
+		}
+
+		if block.kind == markdown.CodeBlock {
+			dc.SetColor(c.theme.CodeBackground)
+			dc.DrawRoundedRectangle(bx, y, width, block.height-block.margin, 4)
+			dc.FillPreserve()
+			dc.SetColor(c.theme.CodeBorder)
+			dc.SetLineWidth(1)
+			dc.Stroke()
+			bx += codeBlockPad
+			y += block.pad
+		}
+
+		for _, line := range block.lines {
+			c.drawLine(ctx, dc, line, bx, y)
+			y += line.height
+		}
+		y += block.pad
+	}
+}
+
+func (c contentLayout) drawLine(ctx context.Context, dc *gg.Context, line contentLine, x, top float64) {
+	baseline := top + line.baseline
+
+	// Inline code backgrounds go under the text, while spoilers are blurred
+	// over it once the whole line is drawn.
+	forEachRun(line.items, x, markdown.Code, func(x0, x1 float64, face font.Face) {
+		m := face.Metrics()
+		ascent, descent := float64(m.Ascent)/64, float64(m.Descent)/64
+		dc.SetColor(c.theme.CodeBackground)
+		dc.DrawRoundedRectangle(x0, baseline-ascent, x1-x0, ascent+descent, 3)
+		dc.Fill()
+	})
+
+	cx := x
+	for _, item := range line.items {
+		switch item.kind {
+		case inlineEmoji:
+			c.drawEmoji(ctx, dc, item, cx+emojiSpacing/2, top+(line.height-item.size)/2, baseline)
+		default:
+			if item.pill != nil {
+				m := item.face.Metrics()
+				ascent, descent := float64(m.Ascent)/64, float64(m.Descent)/64
+				dc.SetColor(item.pill)
+				dc.DrawRoundedRectangle(cx, baseline-ascent, item.width, ascent+descent, 3)
+				dc.Fill()
+			}
+			textlayout.DrawStringAnchored(dc, item.face, item.color, item.text, cx+item.inset, baseline, 0, 0)
+		}
+		drawDecorations(dc, item, cx, baseline)
+		cx += item.width
+	}
+
+	// Spoilers are covered by a solid pill, as the Discord client shows them
+	// until they are clicked.
+	forEachRun(line.items, x, markdown.Spoiler, func(x0, x1 float64, _ font.Face) {
+		rect := image.Rect(int(x0)-1, int(top), int(x1)+1, int(top+line.height))
+		dc.SetColor(c.theme.Spoiler)
+		dc.DrawRoundedRectangle(float64(rect.Min.X), float64(rect.Min.Y)+2, float64(rect.Dx()), float64(rect.Dy())-4, 4)
+		dc.Fill()
+	})
+}
+
+// forEachRun calls fn with the horizontal extent of every run of consecutive
+// items that have the flag set.
+func forEachRun(items []inline, x float64, flag markdown.Style, fn func(x0, x1 float64, face font.Face)) {
+	start := -1.0
+	var face font.Face
+	for _, item := range items {
+		if item.style.Has(flag) {
+			if start < 0 {
+				start, face = x, item.face
+			}
+		} else if start >= 0 {
+			fn(start, x, face)
+			start = -1
+		}
+		x += item.width
+	}
+	if start >= 0 {
+		fn(start, x, face)
+	}
+}
+
+func drawDecorations(dc *gg.Context, item inline, x, baseline float64) {
+	if !item.style.Has(markdown.Underline) && !item.style.Has(markdown.Strike) {
+		return
+	}
+	thickness := max(1, item.size/14)
+	dc.SetColor(item.color)
+	dc.SetLineWidth(thickness)
+	if item.style.Has(markdown.Underline) {
+		y := baseline + thickness + 1
+		dc.DrawLine(x, y, x+item.width, y)
+		dc.Stroke()
+	}
+	if item.style.Has(markdown.Strike) {
+		y := baseline - item.size*0.3
+		dc.DrawLine(x, y, x+item.width, y)
+		dc.Stroke()
+	}
+}
+
+func (c contentLayout) drawEmoji(ctx context.Context, dc *gg.Context, item inline, x, top, baseline float64) {
+	token := item.emoji
+	size := int(item.size)
+
+	switch token.Kind {
+	case emoji.Unicode:
+		sprite, err := assets.Emoji(token.Key)
+		if err != nil {
+			slog.Error("Failed to load emoji sprite", "key", token.Key, "error", err)
+			return
+		}
+		dc.DrawImage(utils.ResizeImage(sprite, size, size), int(x), int(top))
+	case emoji.Custom:
+		img, err := fetch.Image(ctx, token.URL())
+		if err != nil {
+			slog.Warn("Failed to load custom emoji", "id", token.ID, "error", err)
+			warnings.Add(ctx, "custom emoji %s failed to load", token.ID)
+			dc.SetFontFace(item.face)
+			dc.SetColor(item.color)
+			dc.DrawString(":"+token.Name+":", x, baseline)
+			return
+		}
+		drawFitted(dc, img, x, top, item.size)
+	}
+}
+
+// drawFitted scales img to fit a size×size box at (x, y) without distorting
+// it, centring it inside the box.
+func drawFitted(dc *gg.Context, img image.Image, x, y, size float64) {
+	w, h := float64(img.Bounds().Dx()), float64(img.Bounds().Dy())
+	scale := size / max(w, h)
+	fw, fh := max(1, int(w*scale)), max(1, int(h*scale))
+	dc.DrawImage(utils.ResizeImage(img, fw, fh), int(x+(size-float64(fw))/2), int(y+(size-float64(fh))/2))
+}
+
+// blurRect box blurs the pixels of img inside r in place. Three passes of a
+// box blur come close to a gaussian blur.
+func blurRect(img *image.RGBA, r image.Rectangle, radius int) {
+	r = r.Intersect(img.Bounds())
+	if r.Empty() {
+		return
+	}
+	for pass := 0; pass < 3; pass++ {
+		boxBlur(img, r, radius, 1, 0)
+		boxBlur(img, r, radius, 0, 1)
+	}
+}
+
+// boxBlur averages every pixel with its neighbours within radius along the
+// direction (dx, dy).
+func boxBlur(img *image.RGBA, r image.Rectangle, radius, dx, dy int) {
+	length, lines := r.Dx(), r.Dy()
+	if dy == 1 {
+		length, lines = r.Dy(), r.Dx()
+	}
+	buf := make([][4]int, length)
+
+	for l := 0; l < lines; l++ {
+		at := func(i int) int {
+			if dy == 1 {
+				return img.PixOffset(r.Min.X+l, r.Min.Y+i)
+			}
+			return img.PixOffset(r.Min.X+i, r.Min.Y+l)
+		}
+		for i := range buf {
+			o := at(i)
+			buf[i] = [4]int{int(img.Pix[o]), int(img.Pix[o+1]), int(img.Pix[o+2]), int(img.Pix[o+3])}
+		}
+		for i := 0; i < length; i++ {
+			var sum [4]int
+			n := 0
+			for k := max(0, i-radius); k <= min(length-1, i+radius); k++ {
+				for ch := range sum {
+					sum[ch] += buf[k][ch]
+				}
+				n++
+			}
+			o := at(i)
+			for ch := range sum {
+				img.Pix[o+ch] = uint8(sum[ch] / n)
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package skullboard
+
+import (
+	"context"
+	"image"
+	"strings"
+	"testing"
+
+	"jasper/golden"
+)
+
+// words splits text into the text and space items a line is made of.
+func words(text string) []inline {
+	var items []inline
+	for i, word := range strings.Split(text, " ") {
+		if i > 0 {
+			items = append(items, inline{kind: inlineSpace, text: " "})
+		}
+		items = append(items, inline{kind: inlineText, text: word})
+	}
+	return items
+}
+
+func TestVisualOrder(t *testing.T) {
+	tests := []struct {
+		text string
+		rtl  bool
+		want string
+	}{
+		{"hello world", false, "hello world"},
+		{"hello שלום עולם world", false, "hello עולם שלום world"},
+		{"שלום hello עולם", true, "עולם hello שלום"},
+		{"מחיר 100 שקל", true, "שקל 100 מחיר"},
+		{"גרסה 1.2.3 חדשה", true, "חדשה 1.2.3 גרסה"},
+		{"العدد 42", true, "42 العدد"},
+		// Latin words stay in reading order in a right-to-left message.
+		{"hello world", true, "hello world"},
+	}
+	for _, tt := range tests {
+		var got strings.Builder
+		for _, item := range visualOrder(words(tt.text), tt.rtl) {
+			got.WriteString(item.text)
+		}
+		if got.String() != tt.want {
+			t.Errorf("visualOrder(%q, rtl=%v) = %q, want %q", tt.text, tt.rtl, got.String(), tt.want)
+		}
+	}
+}
+
+func TestMixedDirectionGolden(t *testing.T) {
+	server := avatarServer(t)
+	img, err := GenerateDiscordMessage(context.Background(), MessageData{
+		Avatar:   server.URL + "/avatar.png",
+		Username: "alice",
+		Content:  "hello **שלום** עולם world\n\nمرحبا بالعالم 123 hello\n\nמחיר 100 ₪ (הנחה)\n\nالعدد 42 في `(القائمة)`",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.Assert(t, "bidi-message", img)
+}
+
+func TestSpoilerHidesText(t *testing.T) {
+	server := avatarServer(t)
+	for _, name := range ThemeNames() {
+		theme, _ := ThemeByName(name)
+		render := func(secret string) image.Image {
+			img, err := GenerateDiscordMessage(context.Background(), MessageData{
+				Avatar:   server.URL + "/avatar.png",
+				Username: "alice",
+				Content:  "the code is ||" + secret + "||",
+				Theme:    theme,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return img
+		}
+		// The same characters in another order are as wide, so only the hidden
+		// text differs.
+		a, b := render("1208"), render("8021")
+		if a.Bounds() != b.Bounds() {
+			t.Fatalf("%s: renders are %v and %v", name, a.Bounds(), b.Bounds())
+		}
+		shown := 0
+		for y := a.Bounds().Min.Y; y < a.Bounds().Max.Y; y++ {
+			for x := a.Bounds().Min.X; x < a.Bounds().Max.X; x++ {
+				if a.At(x, y) != b.At(x, y) {
+					shown++
+				}
+			}
+		}
+		if shown != 0 {
+			t.Errorf("%s: %d pixels of the text show through the spoiler", name, shown)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package skullboard
+
+import (
+	"context"
+	"errors"
+	"image"
+	"log/slog"
+	"time"
+
+	"github.com/fogleman/gg"
+	"go.opentelemetry.io/otel/attribute"
+
+	"jasper/fetch"
+	"jasper/tracing"
+)
+
+const (
+	// groupWindow is how long after a message the same author's next message
+	// still joins its group, as in the Discord client.
+	groupWindow = 7 * time.Minute
+
+	groupGap   = 16
+	groupedGap = 4
+)
+
+// GenerateConversation renders messages in order as one image, drawn with
+// theme rather than the messages' own themes. Consecutive messages by the same
+// author within groupWindow are grouped, and replies to earlier messages in
+// the list are resolved from them.
+func GenerateConversation(ctx context.Context, messages []MessageData, theme Theme) (image.Image, error) {
+	ctx, span := tracing.Start(ctx, "skullboard.GenerateConversation",
+		attribute.Int("skullboard.messages", len(messages)),
+	)
+	defer span.End()
+
+	if len(messages) == 0 {
+		return nil, tracing.RecordError(span, errors.New("conversation has no messages"))
+	}
+	theme = theme.orDefault()
+	messages = resolveReplies(messages)
+
+	var urls []string
+	for _, msg := range messages {
+		urls = append(urls, msg.imageURLs()...)
+	}
+	ctx = fetch.Prefetch(ctx, urls)
+
+	layouts := make([]messageLayout, 0, len(messages))
+	height := 0.0
+	for i, msg := range messages {
+		msg.Theme = theme
+		grouped := i > 0 && continuesGroup(messages[i-1], msg)
+		if err := ctx.Err(); err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+		laid, err := layoutMessage(ctx, msg, grouped)
+		if err != nil {
+			slog.Error("Failed to lay out message", "index", i, "error", err)
+			return nil, tracing.RecordError(span, err)
+		}
+		if i > 0 {
+			height += gapBefore(laid)
+		}
+		layouts = append(layouts, laid)
+		height += laid.height
+	}
+
+	dc := gg.NewContext(imageWidth, int(height)+padding*2)
+	dc.SetColor(theme.Background)
+	dc.Clear()
+
+	y := float64(padding)
+	for i, laid := range layouts {
+		if err := ctx.Err(); err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+		if i > 0 {
+			y += gapBefore(laid)
+		}
+		if err := laid.draw(ctx, dc, y); err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+		y += laid.height
+	}
+	return dc.Image(), nil
+}
+
+func gapBefore(m messageLayout) float64 {
+	if m.grouped {
+		return groupedGap
+	}
+	return groupGap
+}
+
+// continuesGroup reports whether msg is drawn as part of prev's group. Replies
+// always start a new group. Messages without timestamps are grouped by author
+// alone.
+func continuesGroup(prev, msg MessageData) bool {
+	if msg.hasReply() || !sameAuthor(prev, msg) {
+		return false
+	}
+	if prev.CreatedAt.IsZero() || msg.CreatedAt.IsZero() {
+		return true
+	}
+	d := msg.CreatedAt.Sub(prev.CreatedAt)
+	return d >= 0 && d < groupWindow
+}
+
+func sameAuthor(a, b MessageData) bool {
+	if a.AuthorID != "" || b.AuthorID != "" {
+		return a.AuthorID == b.AuthorID
+	}
+	return a.Username == b.Username && a.Avatar == b.Avatar
+}
+
+// resolveReplies fills in the reply fields of messages that reply to an
+// earlier message in the list, leaving the caller's slice untouched.
+func resolveReplies(messages []MessageData) []MessageData {
+	resolved := make([]MessageData, len(messages))
+	byID := make(map[string]MessageData, len(messages))
+	for i, msg := range messages {
+		if original, ok := byID[msg.ReplyTo]; ok && msg.ReplyTo != "" {
+			msg.ReplyAvatar = original.Avatar
+			msg.ReplyUsername = original.Username
+			msg.ReplyUsernameColor = original.UsernameColor
+			msg.ReplyContent = original.Content
+			msg.ReplyHasAttachments = len(original.Attachments) > 0
+		}
+		if msg.ID != "" {
+			byID[msg.ID] = msg
+		}
+		resolved[i] = msg
+	}
+	return resolved
+}
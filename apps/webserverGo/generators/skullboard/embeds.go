@@ -0,0 +1,407 @@
+package skullboard
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"time"
+
+	"github.com/fogleman/gg"
+
+	"jasper/emoji"
+	"jasper/markdown"
+	"jasper/tracing"
+	"jasper/utils"
+)
+
+// Embed, EmbedMedia and the other embed types follow the shape of Discord's
+// API objects, so a message's embeds can be passed through unchanged.
+type Embed struct {
+	Type        string         `json:"type,omitempty"`
+	Title       string         `json:"title,omitempty"`
+	URL         string         `json:"url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color,omitempty"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+	Author      *EmbedAuthor   `json:"author,omitempty"`
+	Provider    *EmbedProvider `json:"provider,omitempty"`
+	Fields      []EmbedField   `json:"fields,omitempty"`
+	Thumbnail   *EmbedMedia    `json:"thumbnail,omitempty"`
+	Image       *EmbedMedia    `json:"image,omitempty"`
+	Footer      *EmbedFooter   `json:"footer,omitempty"`
+}
+
+type EmbedAuthor struct {
+	Name    string `json:"name"`
+	URL     string `json:"url,omitempty"`
+	IconURL string `json:"icon_url,omitempty"`
+}
+
+type EmbedProvider struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type EmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type EmbedMedia struct {
+	URL string `json:"url"`
+}
+
+type EmbedFooter struct {
+	Text    string `json:"text"`
+	IconURL string `json:"icon_url,omitempty"`
+}
+
+// StickerFormat is Discord's sticker format_type.
+type StickerFormat int
+
+const (
+	StickerPNG    StickerFormat = 1
+	StickerAPNG   StickerFormat = 2
+	StickerLottie StickerFormat = 3
+	StickerGIF    StickerFormat = 4
+)
+
+type Sticker struct {
+	ID         string        `json:"id"`
+	Name       string        `json:"name"`
+	FormatType StickerFormat `json:"format_type"`
+}
+
+// URL returns the image URL of a sticker. Animated stickers are requested as
+// their static first frame.
+func (s Sticker) URL() string {
+	return emoji.CDNBase() + "/stickers/" + s.ID + ".webp?size=160"
+}
+
+const (
+	embedMaxWidth   = 520
+	embedBarWidth   = 4
+	embedPadLeft    = 12
+	embedPadRight   = 16
+	embedPadTop     = 10
+	embedPadBottom  = 12
+	embedGap        = 8
+	embedThumbSize  = 80
+	embedIconSize   = 24
+	footerIconSize  = 20
+	embedImageMaxH  = 300
+	embedFieldGap   = 8
+	embedInlineCols = 3
+	stickerSize     = 160
+)
+
+func embedText(t Theme) textStyle {
+	return textStyle{size: 14, lineHeight: 18, color: t.Text}
+}
+
+func embedBold(t Theme) textStyle {
+	return textStyle{size: 14, lineHeight: 18, color: t.Header, extra: markdown.Bold}
+}
+
+func embedSmall(t Theme) textStyle {
+	return textStyle{size: 12, lineHeight: 16, color: t.Muted}
+}
+
+func embedTitle(t Theme) textStyle {
+	return textStyle{size: 16, lineHeight: 22, color: t.Header, extra: markdown.Bold}
+}
+
+// embedPart is one piece of an embed, positioned relative to the embed's top
+// left corner.
+type embedPart struct {
+	x, y float64
+	draw func(ctx context.Context, dc *gg.Context, x, y float64)
+}
+
+type embedLayout struct {
+	width, height float64
+	background    color.Color
+	bar           color.Color
+	// bare embeds, such as an image link, are drawn as the media alone
+	// without the card around it.
+	bare  bool
+	parts []embedPart
+}
+
+func (e embedLayout) draw(ctx context.Context, dc *gg.Context, x, y float64) {
+	if !e.bare {
+		dc.SetColor(e.bar)
+		dc.DrawRoundedRectangle(x, y, e.width, e.height, 4)
+		dc.Fill()
+		dc.SetColor(e.background)
+		dc.DrawRoundedRectangle(x+embedBarWidth, y, e.width-embedBarWidth, e.height, 4)
+		dc.DrawRectangle(x+embedBarWidth, y, 4, e.height)
+		dc.Fill()
+	}
+	for _, part := range e.parts {
+		part.draw(ctx, dc, x+part.x, y+part.y)
+	}
+}
+
+func textPart(layout contentLayout, x, y float64) embedPart {
+	return embedPart{x: x, y: y, draw: layout.draw}
+}
+
+func imagePart(img image.Image, x, y, w, h float64, round bool) embedPart {
+	return embedPart{x: x, y: y, draw: func(_ context.Context, dc *gg.Context, x, y float64) {
+		scaled := utils.ResizeImage(img, int(w), int(h))
+		if round {
+			dc.DrawCircle(x+w/2, y+h/2, w/2)
+			dc.Clip()
+			defer dc.ResetClip()
+		}
+		dc.DrawImage(scaled, int(x), int(y))
+	}}
+}
+
+// failedPart is the placeholder of an embed image that failed to load.
+func failedPart(theme Theme, x, y, w, h float64) embedPart {
+	return embedPart{x: x, y: y, draw: func(_ context.Context, dc *gg.Context, x, y float64) {
+		drawFailedMedia(dc, theme, x, y, w, h)
+	}}
+}
+
+// fitSize scales w×h down to fit within maxW×maxH, keeping the aspect ratio.
+func fitSize(w, h, maxW, maxH float64) (float64, float64) {
+	scale := min(1, maxW/w, maxH/h)
+	return max(1, w*scale), max(1, h*scale)
+}
+
+func layoutEmbed(ctx context.Context, embed Embed, mentions mentionIndex, theme Theme, maxWidth float64) (embedLayout, error) {
+	ctx, span := tracing.Start(ctx, "skullboard.embed")
+	defer span.End()
+
+	width := min(maxWidth, embedMaxWidth)
+	layout := embedLayout{width: width, background: theme.EmbedBackground, bar: theme.EmbedBar}
+	if embed.Color != 0 {
+		layout.bar = color.RGBA{R: uint8(embed.Color >> 16), G: uint8(embed.Color >> 8), B: uint8(embed.Color), A: 255}
+	}
+
+	// Image and GIF links embed as the media alone.
+	if (embed.Type == "image" || embed.Type == "gifv") && embed.Thumbnail != nil {
+		img := loadOptionalImage(ctx, "embed", embed.Thumbnail.URL)
+		if img == nil {
+			w, h := fitSize(failedMediaWidth, failedMediaHeight, maxWidth, embedImageMaxH)
+			layout.bare, layout.width, layout.height = true, w, h
+			layout.parts = append(layout.parts, failedPart(theme, 0, 0, w, h))
+			return layout, nil
+		}
+		w, h := fitSize(float64(img.Bounds().Dx()), float64(img.Bounds().Dy()), maxWidth, embedImageMaxH)
+		layout.bare, layout.width, layout.height = true, w, h
+		layout.parts = append(layout.parts, imagePart(img, 0, 0, w, h, false))
+		return layout, nil
+	}
+
+	left := float64(embedBarWidth + embedPadLeft)
+	inner := width - left - embedPadRight
+	textWidth := inner
+
+	var thumb image.Image
+	if embed.Thumbnail != nil && embed.Thumbnail.URL != "" {
+		if thumb = loadOptionalImage(ctx, "embed thumbnail", embed.Thumbnail.URL); thumb != nil {
+			textWidth -= embedThumbSize + embedPadRight
+		}
+	}
+
+	y := float64(embedPadTop)
+	addText := func(c contentLayout, x float64) {
+		layout.parts = append(layout.parts, textPart(c, x, y))
+		y += c.height + embedGap/2
+	}
+
+	if embed.Provider != nil && embed.Provider.Name != "" {
+		text, err := layoutText(ctx, embed.Provider.Name, theme, embedSmall(theme), textWidth)
+		if err != nil {
+			return embedLayout{}, tracing.RecordError(span, err)
+		}
+		addText(text, left)
+	}
+
+	if embed.Author != nil && embed.Author.Name != "" {
+		x, top := left, y
+		if icon := loadOptionalImage(ctx, "embed author icon", embed.Author.IconURL); icon != nil {
+			layout.parts = append(layout.parts, imagePart(icon, x, y-2, embedIconSize, embedIconSize, true))
+			x += embedIconSize + 8
+		}
+		text, err := layoutText(ctx, embed.Author.Name, theme, embedBold(theme), textWidth-(x-left))
+		if err != nil {
+			return embedLayout{}, tracing.RecordError(span, err)
+		}
+		addText(text, x)
+		if x > left {
+			y = max(y, top+embedIconSize-2+embedGap/2)
+		}
+	}
+
+	if embed.Title != "" {
+		style := embedTitle(theme)
+		if embed.URL != "" {
+			style.color = theme.Link
+		}
+		text, err := layoutBlocks(ctx, markdown.Parse(embed.Title), mentions, theme, style, textWidth, false)
+		if err != nil {
+			return embedLayout{}, tracing.RecordError(span, err)
+		}
+		addText(text, left)
+	}
+
+	if embed.Description != "" {
+		text, err := layoutBlocks(ctx, markdown.Parse(embed.Description), mentions, theme, embedText(theme), textWidth, false)
+		if err != nil {
+			return embedLayout{}, tracing.RecordError(span, err)
+		}
+		addText(text, left)
+	}
+
+	if len(embed.Fields) > 0 {
+		fieldsY, err := layout.layoutFields(ctx, embed.Fields, mentions, theme, left, y, textWidth)
+		if err != nil {
+			return embedLayout{}, tracing.RecordError(span, err)
+		}
+		y = fieldsY
+	}
+
+	if thumb != nil {
+		w, h := fitSize(float64(thumb.Bounds().Dx()), float64(thumb.Bounds().Dy()), embedThumbSize, embedThumbSize)
+		layout.parts = append(layout.parts, imagePart(thumb, left+inner-w, embedPadTop, w, h, false))
+		y = max(y, embedPadTop+h+embedGap/2)
+	}
+
+	if embed.Image != nil && embed.Image.URL != "" {
+		y += embedGap / 2
+		if img := loadOptionalImage(ctx, "embed image", embed.Image.URL); img != nil {
+			w, h := fitSize(float64(img.Bounds().Dx()), float64(img.Bounds().Dy()), inner, embedImageMaxH)
+			layout.parts = append(layout.parts, imagePart(img, left, y, w, h, false))
+			y += h + embedGap
+		} else {
+			w, h := fitSize(failedMediaWidth, failedMediaHeight, inner, embedImageMaxH)
+			layout.parts = append(layout.parts, failedPart(theme, left, y, w, h))
+			y += h + embedGap
+		}
+	}
+
+	if footer := footerText(embed); footer != "" {
+		x := left
+		if embed.Footer != nil {
+			if icon := loadOptionalImage(ctx, "embed footer icon", embed.Footer.IconURL); icon != nil {
+				layout.parts = append(layout.parts, imagePart(icon, x, y-2, footerIconSize, footerIconSize, true))
+				x += footerIconSize + 8
+			}
+		}
+		text, err := layoutText(ctx, footer, theme, embedSmall(theme), inner-(x-left))
+		if err != nil {
+			return embedLayout{}, tracing.RecordError(span, err)
+		}
+		y += embedGap / 2
+		addText(text, x)
+	}
+
+	layout.height = y - embedGap/2 + embedPadBottom
+	return layout, nil
+}
+
+// layoutFields places fields in rows. Consecutive inline fields share a row,
+// up to three of them, and every other field takes a row of its own.
+func (e *embedLayout) layoutFields(ctx context.Context, fields []EmbedField, mentions mentionIndex, theme Theme, left, y, width float64) (float64, error) {
+	y += embedGap / 2
+	for i := 0; i < len(fields); {
+		row := 1
+		if fields[i].Inline {
+			for row < embedInlineCols && i+row < len(fields) && fields[i+row].Inline {
+				row++
+			}
+		}
+
+		colWidth := (width - embedFieldGap*float64(row-1)) / float64(row)
+		rowHeight := 0.0
+		for col, field := range fields[i : i+row] {
+			x := left + float64(col)*(colWidth+embedFieldGap)
+
+			name, err := layoutBlocks(ctx, markdown.Parse(field.Name), mentions, theme, embedBold(theme), colWidth, false)
+			if err != nil {
+				return 0, err
+			}
+			value, err := layoutBlocks(ctx, markdown.Parse(field.Value), mentions, theme, embedText(theme), colWidth, false)
+			if err != nil {
+				return 0, err
+			}
+			e.parts = append(e.parts, textPart(name, x, y), textPart(value, x, y+name.height+2))
+			rowHeight = max(rowHeight, name.height+2+value.height)
+		}
+		y += rowHeight + embedFieldGap
+		i += row
+	}
+	return y, nil
+}
+
+// footerText joins the footer text and the embed timestamp the way Discord
+// shows them, e.g. "Jasper • 01/02/2024 3:04 PM".
+func footerText(embed Embed) string {
+	text := ""
+	if embed.Footer != nil {
+		text = embed.Footer.Text
+	}
+	if embed.Timestamp == "" {
+		return text
+	}
+	t, err := time.Parse(time.RFC3339, embed.Timestamp)
+	if err != nil {
+		return text
+	}
+	stamp := t.UTC().Format("01/02/2006 3:04 PM")
+	if text == "" {
+		return stamp
+	}
+	return fmt.Sprintf("%s • %s", text, stamp)
+}
+
+type stickerLayout struct {
+	sticker    Sticker
+	img        image.Image
+	name       contentLayout
+	background color.Color
+}
+
+// layoutSticker fetches a sticker image. Lottie stickers are vector animations
+// that can't be fetched as an image, so they are drawn as a card with the
+// sticker name instead.
+func layoutSticker(ctx context.Context, sticker Sticker, theme Theme) (stickerLayout, error) {
+	ctx, span := tracing.Start(ctx, "skullboard.sticker")
+	defer span.End()
+
+	if sticker.FormatType == StickerLottie {
+		name, err := layoutText(ctx, sticker.Name, theme, embedText(theme), stickerSize-16)
+		if err != nil {
+			return stickerLayout{}, tracing.RecordError(span, err)
+		}
+		return stickerLayout{sticker: sticker, name: name, background: theme.EmbedBackground}, nil
+	}
+
+	if img := loadOptionalImage(ctx, "sticker", sticker.URL()); img != nil {
+		return stickerLayout{sticker: sticker, img: img}, nil
+	}
+	// Stickers that fail to load fall back to the card Lottie stickers get.
+	name, err := layoutText(ctx, sticker.Name, theme, embedText(theme), stickerSize-16)
+	if err != nil {
+		return stickerLayout{}, tracing.RecordError(span, err)
+	}
+	return stickerLayout{sticker: sticker, name: name, background: theme.EmbedBackground}, nil
+}
+
+func (s stickerLayout) draw(ctx context.Context, dc *gg.Context, x, y float64) {
+	if s.img != nil {
+		drawFitted(dc, s.img, x, y, stickerSize)
+		return
+	}
+	dc.SetColor(s.background)
+	dc.DrawRoundedRectangle(x, y, stickerSize, stickerSize, 8)
+	dc.Fill()
+	s.name.draw(ctx, dc, x+8, y+(stickerSize-s.name.height)/2)
+}
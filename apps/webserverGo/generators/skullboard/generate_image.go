@@ -1,33 +1,79 @@
 package skullboard
 
 import (
+	"context"
 	"image"
-	"image/color"
 	"log/slog"
-	"regexp"
-	"strings"
+	"time"
 
 	"github.com/fogleman/gg"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/image/font"
 
+	"jasper/emoji"
+	"jasper/fetch"
+	"jasper/fonts"
+	"jasper/textlayout"
+	"jasper/tracing"
 	"jasper/utils"
+	"jasper/warnings"
 )
 
 type MessageData struct {
+	// ID, AuthorID and CreatedAt are only needed in conversations, to resolve
+	// replies and to group consecutive messages by the same author.
+	ID        string
+	AuthorID  string
+	CreatedAt time.Time
+	ReplyTo   string
+
 	ReplyAvatar        string
 	ReplyUsernameColor string
 	ReplyUsername      string
 	ReplyContent       string
+	// ReplyHasAttachments marks a replied-to message with attachments. Without
+	// ReplyContent the preview reads "Click to see attachment".
+	ReplyHasAttachments bool
+	// ReplyDeleted draws the reply line of a message whose original was deleted.
+	ReplyDeleted bool
+
+	Avatar        string
+	UsernameColor string
+	Username      string
+	RoleIconURL   string
+	Timestamp     string
+	Content       string
+	Mentions      []Mention
+
+	Attachments []Attachment
+	Embeds      []Embed
+	Stickers    []Sticker
+
+	// Theme defaults to DarkTheme.
+	Theme Theme
+}
+
+// messageLayout holds everything measured and fetched up front, so the image
+// can be sized before anything is drawn.
+type messageLayout struct {
+	data  MessageData
+	theme Theme
+	face  font.Face
+
+	// grouped messages continue the previous message's group and are drawn
+	// without the reply, avatar and username header.
+	grouped bool
+
+	replyAvatar image.Image
+	avatar      image.Image
+	roleIcon    image.Image
 
-	Avatar          string
-	UsernameColor   string
-	Username        string
-	RoleIconURL     string
-	Timestamp       string
-	Content         string
-    Mentions    []string
+	content     contentLayout
+	attachments attachmentsLayout
+	embeds      []embedLayout
+	stickers    []stickerLayout
 
-	Attachments []string
+	height float64
 }
 
 const (
@@ -37,205 +83,245 @@ const (
 	fontSize    = 16
 	lineHeight  = fontSize * 1.5
 	messageBoxX = float64(padding + pfpSize + textMargin)
+
+	imageWidth      = 800
+	messageMaxWidth = imageWidth - padding*2 - pfpSize - textMargin
+	replyHeight     = 40
 )
 
-func replaceMentionsFromMessageContent(content string, mentions []string) string {
-    for _, mention := range mentions {
-        splittedMention := strings.Split(mention, ":")
-        if len(splittedMention) != 2 {
-            continue
-        }
-        content = strings.ReplaceAll(content, "<@"+splittedMention[0]+">", "\u200b@"+splittedMention[1]+"\u200b")
-        content = strings.ReplaceAll(content, "<@!"+splittedMention[0]+">", "\u200b@"+splittedMention[1]+"\u200b")
-        content = strings.ReplaceAll(content, "<#"+splittedMention[0]+">", "\u200b#"+splittedMention[1]+"\u200b")
-    }
-    return content
+func layoutMessage(ctx context.Context, data MessageData, grouped bool) (messageLayout, error) {
+	ctx, span := tracing.Start(ctx, "skullboard.measure")
+	defer span.End()
+
+	face, err := fonts.Face(fonts.Discord, fontSize)
+	if err != nil {
+		slog.Error("Failed to load font", "family", fonts.Discord, "error", err)
+		return messageLayout{}, tracing.RecordError(span, err)
+	}
+	theme := data.Theme.orDefault()
+	layout := messageLayout{data: data, theme: theme, face: face, grouped: grouped}
+
+	if !grouped {
+		layout.fetchHeader(ctx)
+		layout.height = lineHeight
+		if data.hasReply() {
+			layout.height += replyHeight
+		}
+	}
+
+	layout.content, err = layoutContent(ctx, data, messageMaxWidth)
+	if err != nil {
+		slog.Error("Failed to lay out message content", "error", err)
+		return messageLayout{}, tracing.RecordError(span, err)
+	}
+	layout.height += layout.content.height
+
+	if len(data.Attachments) > 0 {
+		layout.attachments, err = layoutAttachments(ctx, data.Attachments, theme, messageMaxWidth)
+		if err != nil {
+			slog.Error("Failed to lay out attachments", "error", err)
+			return messageLayout{}, tracing.RecordError(span, err)
+		}
+		layout.height += layout.attachments.height + embedGap
+	}
+
+	mentions := newMentionIndex(data.Mentions)
+	for _, embed := range data.Embeds {
+		laid, err := layoutEmbed(ctx, embed, mentions, theme, messageMaxWidth)
+		if err != nil {
+			slog.Error("Failed to lay out embed", "error", err)
+			return messageLayout{}, tracing.RecordError(span, err)
+		}
+		layout.embeds = append(layout.embeds, laid)
+		layout.height += laid.height + embedGap
+	}
+
+	for _, sticker := range data.Stickers {
+		laid, err := layoutSticker(ctx, sticker, theme)
+		if err != nil {
+			slog.Error("Failed to lay out sticker", "id", sticker.ID, "error", err)
+			return messageLayout{}, tracing.RecordError(span, err)
+		}
+		layout.stickers = append(layout.stickers, laid)
+		layout.height += stickerSize + embedGap
+	}
+
+	if !grouped {
+		layout.height = max(layout.height, pfpSize)
+	}
+	return layout, nil
 }
 
-func calculateWidthHeight(font font.Face, data MessageData) (int, int, error) {
-	width := 800 
-    height := 0
+// fetchHeader loads the images of the reply line and the message header.
+// Avatars that fail to load are replaced by default avatars and a failing role
+// icon is left out.
+func (m *messageLayout) fetchHeader(ctx context.Context) {
+	data := m.data
 
-	tempDC := gg.NewContext(10000, 10000)
-	tempDC.SetFontFace(font)
+	if data.hasReply() && !data.ReplyDeleted {
+		replyCtx, replySpan := tracing.Start(ctx, "skullboard.reply")
+		m.replyAvatar = loadAvatar(replyCtx, "reply avatar", data.ReplyAvatar, data.ReplyUsername)
+		replySpan.End()
+	}
 
-	messageMaxWidth := float64(width - padding*2 - pfpSize - textMargin)
-	lines := tempDC.WordWrap(replaceMentionsFromMessageContent(data.Content, data.Mentions), messageMaxWidth)
-	messageHeight := float64(len(lines)) * lineHeight
-    height = int(messageHeight + padding*2)
+	headerCtx, headerSpan := tracing.Start(ctx, "skullboard.header")
+	defer headerSpan.End()
 
+	avatarKey := data.AuthorID
+	if avatarKey == "" {
+		avatarKey = data.Username
+	}
+	m.avatar = loadAvatar(headerCtx, "avatar", data.Avatar, avatarKey)
 
-	usernameHeight := fontSize + 2
-	height += usernameHeight
+	m.roleIcon = loadOptionalImage(headerCtx, "role icon", data.RoleIconURL)
+}
 
-    // Add reply height if present
-    if data.ReplyContent != "" {
-        height += 50
-    }
+// imageURLs lists every image the message may draw, so they can be fetched
+// in parallel before laying it out.
+func (d MessageData) imageURLs() []string {
+	urls := []string{d.Avatar, d.RoleIconURL}
+	if d.hasReply() && !d.ReplyDeleted {
+		urls = append(urls, d.ReplyAvatar)
+	}
 
-	// Add attachment heights
-	if len(data.Attachments) > 0 {
-		for _, attachmentURL := range data.Attachments {
-			attachmentImage, err := utils.LoadImageFromURL(attachmentURL)
-			if err != nil {
-				slog.Error("Failed to load attachment image", "url", attachmentURL, "error", err)
-				return 0, 0, err
-			}
-			
-			// Scale attachment to fit within available width if necessary
-			attachmentWidth := attachmentImage.Bounds().Dx()
-			attachmentHeight := attachmentImage.Bounds().Dy()
-			
-			maxAttachmentWidth := width - int(messageBoxX)
-			if attachmentWidth > maxAttachmentWidth {
-				// Scale down proportionally
-				scale := float64(maxAttachmentWidth) / float64(attachmentWidth)
-				attachmentHeight = int(float64(attachmentHeight) * scale)
+	for _, token := range emoji.Parse(d.Content) {
+		if token.Kind == emoji.Custom {
+			urls = append(urls, token.URL())
+		}
+	}
+
+	media := 0
+	for _, attachment := range d.Attachments {
+		if attachment.Kind() != AttachmentFile && media < maxMosaicMedia {
+			urls = append(urls, attachment.imageURL())
+			media++
+		}
+	}
+
+	for _, embed := range d.Embeds {
+		for _, media := range []*EmbedMedia{embed.Thumbnail, embed.Image} {
+			if media != nil {
+				urls = append(urls, media.URL)
 			}
-			
-			height += attachmentHeight + 20
+		}
+		if embed.Author != nil {
+			urls = append(urls, embed.Author.IconURL)
+		}
+		if embed.Footer != nil {
+			urls = append(urls, embed.Footer.IconURL)
 		}
 	}
 
-	return width, height, nil
+	for _, sticker := range d.Stickers {
+		if sticker.FormatType != StickerLottie {
+			urls = append(urls, sticker.URL())
+		}
+	}
+	return urls
 }
 
-func GenerateDiscordMessage(data MessageData) (image.Image, error) {
-	font, err := utils.LoadFont("./fonts/Roboto-Regular.ttf", fontSize)
+// loadOptionalImage fetches an image the message can be drawn without. On
+// failure it logs, records a warning for the response and returns nil. An
+// empty URL returns nil without a warning.
+func loadOptionalImage(ctx context.Context, what, rawURL string) image.Image {
+	if rawURL == "" {
+		return nil
+	}
+	img, err := fetch.Image(ctx, rawURL)
 	if err != nil {
-		slog.Error("Failed to load font", "fontPath", "./fonts/Roboto-Regular.ttf", "error", err)
-		return nil, err
+		slog.Warn("Failed to load optional image", "element", what, "url", rawURL, "error", err)
+		warnings.Add(ctx, "%s %s failed to load", what, rawURL)
+		return nil
 	}
+	return img
+}
+
+func GenerateDiscordMessage(ctx context.Context, data MessageData) (image.Image, error) {
+	ctx, span := tracing.Start(ctx, "skullboard.GenerateDiscordMessage",
+		attribute.Int("skullboard.attachments", len(data.Attachments)),
+		attribute.Bool("skullboard.reply", data.hasReply()),
+	)
+	defer span.End()
 
-	totalWidth, totalHeight, err := calculateWidthHeight(font, data)
+	ctx = fetch.Prefetch(ctx, data.imageURLs())
+	layout, err := layoutMessage(ctx, data, false)
 	if err != nil {
-		slog.Error("Failed to calculate width and height", "error", err)
-		return nil, err
+		slog.Error("Failed to lay out message", "error", err)
+		return nil, tracing.RecordError(span, err)
+	}
+
+	// Images that failed because the request was cancelled were replaced by
+	// placeholders, so stop here rather than draw them.
+	if err := ctx.Err(); err != nil {
+		return nil, tracing.RecordError(span, err)
 	}
 
-	dc := gg.NewContext(totalWidth, totalHeight)
-	dc.SetRGB(50/255.0, 51/255.0, 56/255.0)
+	dc := gg.NewContext(imageWidth, int(layout.height)+padding*2)
+	dc.SetColor(layout.theme.Background)
 	dc.Clear()
-	dc.SetFontFace(font)
 
-	currentY := float64(padding)
+	if err := layout.draw(ctx, dc, padding); err != nil {
+		return nil, tracing.RecordError(span, err)
+	}
+	return dc.Image(), nil
+}
 
-	if data.ReplyContent != "" {
-		currentX := padding + 18
-		replySymbol, err := gg.LoadImage("./generators/skullboard/discord_reply.png")
-		if err != nil {
-			slog.Error("Failed to load reply symbol image", "error", err)
-			return nil, err
-		}
-		replySymbol = utils.ResizeImage(replySymbol, 104*40/54, 40)
-		dc.DrawImage(replySymbol, int(currentX), int(currentY))
-		currentX += 104*40/54 + 10
+// draw renders the message with its top at y.
+func (m messageLayout) draw(ctx context.Context, dc *gg.Context, y float64) error {
+	data := m.data
+	currentY := y
+	dc.SetFontFace(m.face)
 
-		replyAvatar, err := utils.LoadImageFromURL(data.ReplyAvatar)
-		if err != nil {
-			slog.Error("Failed to load reply avatar image", "url", data.ReplyAvatar, "error", err)
-			return nil, err
+	if !m.grouped {
+		if data.hasReply() {
+			if err := m.drawReply(dc, currentY); err != nil {
+				return err
+			}
+			currentY += replyHeight
 		}
-		replyAvatar = utils.ResizeImage(replyAvatar, 30, 30)
-		dc.DrawCircle(float64(currentX+15), float64(currentY+15), 15)
+
+		pfp := utils.ResizeImage(m.avatar, pfpSize, pfpSize)
+		dc.DrawCircle(float64(padding+pfpSize/2), float64(currentY+pfpSize/2), float64(pfpSize/2))
 		dc.Clip()
-		dc.DrawImageAnchored(replyAvatar, int(currentX)+15, int(currentY)+15, 0.5, 0.5)
+		dc.DrawImageAnchored(pfp, padding+pfpSize/2, int(currentY)+pfpSize/2, 0.5, 0.5)
 		dc.ResetClip()
-		currentX += 35
-		currentY += 10
-
-		dc.SetRGB(utils.ConvertHexColor(data.ReplyUsernameColor))
-		dc.DrawStringAnchored(data.ReplyUsername, float64(currentX), currentY, 0, 0.5)
-		usernameWidth, _ := dc.MeasureString(data.ReplyUsername)
-		currentX += int(usernameWidth + 5)
 
-		dc.SetRGB(0.7, 0.7, 0.7)
-		dc.DrawStringAnchored(data.ReplyContent, float64(currentX), currentY, 0, 0.5)
+		textlayout.DrawStringAnchored(dc, m.face, m.theme.textColor(data.UsernameColor), data.Username, messageBoxX, float64(currentY+fontSize), 0, 0)
+		usernameWidth := measure(m.face, data.Username)
 
-		currentY += 30
-	}
+		if m.roleIcon != nil {
+			roleIcon := utils.ResizeImage(m.roleIcon, 22, 22)
+			dc.DrawImageAnchored(roleIcon, int(messageBoxX+usernameWidth+20), int(currentY+fontSize), 0.5, 0.75)
+		}
 
-	pfp, err := utils.LoadImageFromURL(data.Avatar)
-	if err != nil {
-		slog.Error("Failed to load avatar image", "url", data.Avatar, "error", err)
-		return nil, err
+		timestampX := messageBoxX + usernameWidth + 10
+		if m.roleIcon != nil {
+			timestampX += 18 + 10
+		}
+		dc.SetColor(m.theme.Muted)
+		dc.DrawStringAnchored(data.Timestamp, timestampX, float64(currentY+fontSize), 0, 0)
+		currentY += lineHeight
 	}
-	pfp = utils.ResizeImage(pfp, pfpSize, pfpSize)
-	dc.DrawCircle(float64(padding+pfpSize/2), float64(currentY+pfpSize/2), float64(pfpSize/2))
-	dc.Clip()
-	dc.DrawImageAnchored(pfp, padding+pfpSize/2, int(currentY)+pfpSize/2, 0.5, 0.5)
-	dc.ResetClip()
 
-	dc.SetRGB(utils.ConvertHexColor(data.UsernameColor))
-	dc.DrawStringAnchored(data.Username, messageBoxX, float64(currentY+fontSize), 0, 0)
-	usernameWidth, _ := dc.MeasureString(data.Username)
+	m.content.draw(ctx, dc, messageBoxX, currentY)
+	currentY += m.content.height
 
-	if data.RoleIconURL != "" {
-		roleIcon, err := utils.LoadImageFromURL(data.RoleIconURL)
-		if err != nil {
-			slog.Error("Failed to load role icon image", "url", data.RoleIconURL, "error", err)
-			return nil, err
-		}
-		roleIcon = utils.ResizeImage(roleIcon, 22, 22)
-		dc.DrawImageAnchored(roleIcon, int(messageBoxX+usernameWidth+20), int(currentY+fontSize), 0.5, 0.75)
-	}
-
-	timestampX := messageBoxX + usernameWidth + 10
-	if data.RoleIconURL != "" {
-		timestampX += 18 + 10
-	}
-	dc.SetFontFace(font)
-	dc.SetRGB(0.7, 0.7, 0.7)
-	dc.DrawStringAnchored(data.Timestamp, timestampX, float64(currentY+fontSize), 0, 0)
-	currentY += fontSize * 2.5
-
-    mentionColor := color.RGBA{R: 66, G: 135, B: 245, A: 255}
-    normalColor := color.RGBA{R: 230, G: 230, B: 230, A: 255}
-
-	lines := dc.WordWrap(replaceMentionsFromMessageContent(data.Content, data.Mentions), float64(totalWidth-padding*2-pfpSize-textMargin))
-    regex := regexp.MustCompile(`\x{200b}(@|#)[^ ]+\x{200b}`)
-
-	for _, line := range lines {
-        x := messageBoxX
-        lastIndex := 0
-        matches := regex.FindAllStringIndex(line, -1)
-
-        for _, match := range matches {
-            start, end := match[0], match[1]
-            if start > lastIndex {
-                dc.SetColor(normalColor)
-                text := line[lastIndex:start]
-                dc.DrawStringAnchored(text, x, currentY, 0, 0)
-                w, _ := dc.MeasureString(text)
-                x += w
-            }
-            dc.SetColor(mentionColor)
-            text := line[start:end]
-            dc.DrawStringAnchored(text, x, currentY, 0, 0)
-            w, _ := dc.MeasureString(text)
-            x += w
-            lastIndex = end
-        }
-        if lastIndex < len(line) {
-            dc.SetColor(normalColor)
-            text := line[lastIndex:]
-            dc.DrawStringAnchored(text, x, currentY, 0, 0)
-        }
-        currentY += lineHeight
+	if len(data.Attachments) > 0 {
+		currentY += embedGap
+		m.attachments.draw(ctx, dc, messageBoxX, currentY)
+		currentY += m.attachments.height
 	}
 
-	if len(data.Attachments) > 0 {
-		for _, attachmentURL := range data.Attachments {
-			attachmentImage, err := utils.LoadImageFromURL(attachmentURL)
-			if err != nil {
-				slog.Error("Failed to load attachment image", "url", attachmentURL, "error", err)
-				return nil, err
-			}
-			attachmentY := int(currentY)
-			dc.DrawImage(attachmentImage, int(messageBoxX), attachmentY)
-			currentY += float64(attachmentImage.Bounds().Dy()) + 20
-		}
+	for _, embed := range m.embeds {
+		currentY += embedGap
+		embed.draw(ctx, dc, messageBoxX, currentY)
+		currentY += embed.height
 	}
 
-	return dc.Image(), nil
-}
\ No newline at end of file
+	for _, sticker := range m.stickers {
+		currentY += embedGap
+		sticker.draw(ctx, dc, messageBoxX, currentY)
+		currentY += stickerSize
+	}
+	return nil
+}
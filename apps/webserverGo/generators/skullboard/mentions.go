@@ -0,0 +1,195 @@
+package skullboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"jasper/utils"
+)
+
+type MentionType string
+
+const (
+	MentionUser    MentionType = "user"
+	MentionRole    MentionType = "role"
+	MentionChannel MentionType = "channel"
+)
+
+// Mention resolves a <@id>, <@&id> or <#id> token in the message content to
+// the name shown in its place. Color is the role color as "#rrggbb" and only
+// applies to roles.
+type Mention struct {
+	Type  MentionType `json:"type"`
+	ID    string      `json:"id"`
+	Name  string      `json:"name"`
+	Color string      `json:"color,omitempty"`
+}
+
+// UnmarshalJSON also accepts the older "id:name" strings, which resolve both
+// user and channel mentions with that id. Strings without a colon, like the
+// bot's "no-name" and "voice-channel" placeholders, become mentions without
+// an id, which match no token.
+func (m *Mention) UnmarshalJSON(data []byte) error {
+	var legacy string
+	if err := json.Unmarshal(data, &legacy); err == nil {
+		id, name, ok := strings.Cut(legacy, ":")
+		if !ok {
+			*m = Mention{Name: legacy}
+			return nil
+		}
+		*m = Mention{ID: id, Name: name}
+		return nil
+	}
+
+	type plain Mention
+	return json.Unmarshal(data, (*plain)(m))
+}
+
+var mentionRegex = regexp.MustCompile(`<@!?(\d+)>|<@&(\d+)>|<#(\d+)>|</([^:<>]+):(\d+)>|<t:(-?\d+)(?::([tTdDfFR]))?>|@everyone|@here`)
+
+// mentionIndex looks mentions up by type and id.
+type mentionIndex map[string]Mention
+
+func newMentionIndex(mentions []Mention) mentionIndex {
+	index := make(mentionIndex, len(mentions))
+	for _, m := range mentions {
+		if m.ID == "" {
+			continue
+		}
+		if m.Type == "" {
+			index[string(MentionUser)+":"+m.ID] = m
+			index[string(MentionChannel)+":"+m.ID] = m
+			continue
+		}
+		index[string(m.Type)+":"+m.ID] = m
+	}
+	return index
+}
+
+func (idx mentionIndex) name(t MentionType, id, fallback string) (string, Mention) {
+	m, ok := idx[string(t)+":"+id]
+	if !ok || m.Name == "" {
+		return fallback, m
+	}
+	return m.Name, m
+}
+
+// segments splits text into plain runs and the pills Discord draws for
+// mentions, slash commands and timestamps.
+func (idx mentionIndex) segments(text string, base color.Color, theme Theme) []segment {
+	var segments []segment
+	last := 0
+	for _, m := range mentionRegex.FindAllStringSubmatchIndex(text, -1) {
+		if m[0] > last {
+			segments = append(segments, segment{text: text[last:m[0]], color: base})
+		}
+		last = m[1]
+
+		group := func(i int) string {
+			if m[2*i] < 0 {
+				return ""
+			}
+			return text[m[2*i]:m[2*i+1]]
+		}
+		pill := segment{color: theme.Mention, pill: theme.MentionPill}
+		switch {
+		case group(1) != "":
+			name, _ := idx.name(MentionUser, group(1), "unknown-user")
+			pill.text = "@" + name
+		case group(2) != "":
+			name, role := idx.name(MentionRole, group(2), "unknown-role")
+			pill.text = "@" + name
+			if c, ok := roleColor(role.Color); ok {
+				pill.color = c
+				pill.pill = color.NRGBA{R: c.R, G: c.G, B: c.B, A: 26}
+			}
+		case group(3) != "":
+			name, _ := idx.name(MentionChannel, group(3), "unknown")
+			pill.text = "#" + name
+		case group(4) != "":
+			pill.text = "/" + group(4)
+		case group(6) != "":
+			unix, err := strconv.ParseInt(group(6), 10, 64)
+			if err != nil {
+				pill = segment{text: text[m[0]:m[1]], color: base}
+				break
+			}
+			pill = segment{text: formatTimestamp(time.Unix(unix, 0).UTC(), group(7), time.Now()), color: base, pill: theme.TimestampPill}
+		default:
+			pill.text = text[m[0]:m[1]]
+		}
+		segments = append(segments, pill)
+	}
+	if last < len(text) {
+		segments = append(segments, segment{text: text[last:], color: base})
+	}
+	return segments
+}
+
+// roleColor parses a role color. Discord uses black for roles without one.
+func roleColor(hex string) (color.RGBA, bool) {
+	if hex == "" || strings.EqualFold(hex, "#000000") {
+		return color.RGBA{}, false
+	}
+	r, g, b := utils.ConvertHexColor(hex)
+	return color.RGBA{R: uint8(r * 255), G: uint8(g * 255), B: uint8(b * 255), A: 255}, true
+}
+
+// formatTimestamp formats a <t:unix:style> token the way an en-US Discord
+// client does, in UTC.
+func formatTimestamp(t time.Time, style string, now time.Time) string {
+	switch style {
+	case "t":
+		return t.Format("3:04 PM")
+	case "T":
+		return t.Format("3:04:05 PM")
+	case "d":
+		return t.Format("01/02/2006")
+	case "D":
+		return t.Format("January 2, 2006")
+	case "F":
+		return t.Format("Monday, January 2, 2006 3:04 PM")
+	case "R":
+		return relativeTime(t, now)
+	}
+	return t.Format("January 2, 2006 3:04 PM")
+}
+
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+		{"second", time.Second},
+	}
+	amount, unit := 0, "second"
+	for _, u := range units {
+		if d >= u.size {
+			amount, unit = int(d/u.size), u.name
+			break
+		}
+	}
+	if amount != 1 {
+		unit += "s"
+	}
+	if future {
+		return fmt.Sprintf("in %d %s", amount, unit)
+	}
+	return fmt.Sprintf("%d %s ago", amount, unit)
+}
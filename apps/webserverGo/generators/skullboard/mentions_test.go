@@ -0,0 +1,68 @@
+package skullboard
+
+import (
+	"encoding/json"
+	"image/color"
+	"testing"
+)
+
+// The payloads the bot's skullboard listener and snipe command send, with
+// the placeholders they use for DM and voice channels.
+func TestMentionLegacyPayloads(t *testing.T) {
+	payloads := []string{
+		`["123:alice", "456:general"]`,
+		`["123:alice", "no-name"]`,
+		`["voice-channel", "456:general"]`,
+		`["no-name", "voice-channel"]`,
+	}
+	for _, payload := range payloads {
+		var mentions []Mention
+		if err := json.Unmarshal([]byte(payload), &mentions); err != nil {
+			t.Errorf("decoding %s: %v", payload, err)
+		}
+	}
+
+	var body struct {
+		Mentions []Mention `json:"mentions"`
+	}
+	payload := `{"content": "hi <@123> in <#456> and <#789>", "mentions": ["123:alice", "456:general", "no-name", "voice-channel"]}`
+	if err := json.Unmarshal([]byte(payload), &body); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	want := []Mention{{ID: "123", Name: "alice"}, {ID: "456", Name: "general"}, {Name: "no-name"}, {Name: "voice-channel"}}
+	if len(body.Mentions) != len(want) {
+		t.Fatalf("got %d mentions, want %d", len(body.Mentions), len(want))
+	}
+	for i, m := range body.Mentions {
+		if m != want[i] {
+			t.Errorf("mention %d = %+v, want %+v", i, m, want[i])
+		}
+	}
+
+	idx := newMentionIndex(body.Mentions)
+	var texts []string
+	for _, s := range idx.segments("hi <@123> in <#456> and <#789>", color.White, DarkTheme) {
+		texts = append(texts, s.text)
+	}
+	wantTexts := []string{"hi ", "@alice", " in ", "#general", " and ", "#unknown"}
+	if len(texts) != len(wantTexts) {
+		t.Fatalf("segments = %q, want %q", texts, wantTexts)
+	}
+	for i := range texts {
+		if texts[i] != wantTexts[i] {
+			t.Errorf("segments = %q, want %q", texts, wantTexts)
+			break
+		}
+	}
+}
+
+func TestMentionObject(t *testing.T) {
+	var m Mention
+	if err := json.Unmarshal([]byte(`{"type": "role", "id": "9", "name": "mods", "color": "#ff0000"}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	want := Mention{Type: MentionRole, ID: "9", Name: "mods", Color: "#ff0000"}
+	if m != want {
+		t.Errorf("got %+v, want %+v", m, want)
+	}
+}
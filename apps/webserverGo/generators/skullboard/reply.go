@@ -0,0 +1,163 @@
+package skullboard
+
+import (
+	"image/color"
+	"log/slog"
+	"math"
+	"strings"
+
+	"github.com/fogleman/gg"
+
+	"jasper/emoji"
+	"jasper/fonts"
+	"jasper/markdown"
+	"jasper/textlayout"
+	"jasper/utils"
+)
+
+const (
+	replyAvatarSize = 30
+	replyIconWidth  = 18
+	replyIconHeight = 14
+
+	replySpineWidth  = 77
+	replySpineHeight = 40
+	replySpineRadius = 9
+)
+
+// hasReply reports whether the message is drawn with a reply line above it.
+func (d MessageData) hasReply() bool {
+	return d.ReplyContent != "" || d.ReplyHasAttachments || d.ReplyDeleted
+}
+
+// replyPreview flattens the replied-to content to a single line the way the
+// Discord client previews it: markdown is stripped, mentions are resolved and
+// custom emoji are shown by name.
+func replyPreview(content string, mentions mentionIndex, theme Theme) string {
+	var parts []string
+	for _, block := range markdown.Parse(content) {
+		text := block.Code
+		if block.Kind != markdown.CodeBlock {
+			text = markdown.PlainText(block.Spans)
+		}
+		for _, seg := range mentions.segments(text, theme.Muted, theme) {
+			for _, token := range emoji.Parse(seg.text) {
+				if token.Kind == emoji.Custom {
+					parts = append(parts, ":"+token.Name+":")
+					continue
+				}
+				parts = append(parts, token.Text)
+			}
+		}
+		parts = append(parts, " ")
+	}
+	return strings.Join(strings.Fields(strings.Join(parts, "")), " ")
+}
+
+// drawReplySpine draws the curved line from the avatar up and over to the
+// replied-to message, with its top left corner at (x, y).
+func drawReplySpine(dc *gg.Context, x, y float64, c color.Color) {
+	left, top := x+7, y+13
+	bottom := y + replySpineHeight - 4
+	dc.MoveTo(left, bottom)
+	dc.LineTo(left, top+replySpineRadius)
+	dc.DrawArc(left+replySpineRadius, top+replySpineRadius, replySpineRadius, math.Pi, 1.5*math.Pi)
+	dc.LineTo(x+replySpineWidth, top)
+	dc.SetColor(c)
+	dc.SetLineWidth(2)
+	dc.Stroke()
+}
+
+// drawReply draws the reply line with its top at y: the reply spine, then the
+// replied-to author and a preview of their message cut to the image width.
+func (m messageLayout) drawReply(dc *gg.Context, y float64) error {
+	data := m.data
+	currentX := float64(padding + 18)
+	drawReplySpine(dc, currentX, y, m.theme.QuoteBar)
+	currentX += replySpineWidth + 10
+
+	italic, err := fonts.Face(fonts.DiscordItalic, fontSize)
+	if err != nil {
+		slog.Error("Failed to load font", "family", fonts.DiscordItalic, "error", err)
+		return err
+	}
+
+	centerY := y + 10
+	maxX := float64(imageWidth - padding)
+
+	if data.ReplyDeleted {
+		dc.SetColor(m.theme.CodeBackground)
+		dc.DrawCircle(currentX+replyAvatarSize/2, y+replyAvatarSize/2, replyAvatarSize/2)
+		dc.Fill()
+		drawDeletedGlyph(dc, currentX+replyAvatarSize/2, y+replyAvatarSize/2, m.theme.Muted)
+		currentX += replyAvatarSize + 5
+
+		dc.SetFontFace(italic)
+		dc.SetColor(m.theme.Muted)
+		dc.DrawStringAnchored(ellipsize(italic, "Original message was deleted", maxX-currentX), currentX, centerY, 0, 0.5)
+		dc.SetFontFace(m.face)
+		return nil
+	}
+
+	replyAvatar := utils.ResizeImage(m.replyAvatar, replyAvatarSize, replyAvatarSize)
+	dc.DrawCircle(currentX+replyAvatarSize/2, y+replyAvatarSize/2, replyAvatarSize/2)
+	dc.Clip()
+	dc.DrawImageAnchored(replyAvatar, int(currentX)+replyAvatarSize/2, int(y)+replyAvatarSize/2, 0.5, 0.5)
+	dc.ResetClip()
+	currentX += replyAvatarSize + 5
+
+	username := ellipsize(m.face, data.ReplyUsername, (maxX-currentX)/2)
+	textlayout.DrawStringAnchored(dc, m.face, m.theme.textColor(data.ReplyUsernameColor), username, currentX, centerY, 0, 0.5)
+	currentX += measure(m.face, username) + 5
+
+	iconSpace := 0.0
+	if data.ReplyHasAttachments {
+		iconSpace = replyIconWidth + 5
+	}
+
+	preview := replyPreview(data.ReplyContent, newMentionIndex(data.Mentions), m.theme)
+	face := m.face
+	if preview == "" {
+		preview, face = "Click to see attachment", italic
+	}
+	preview = ellipsize(face, preview, maxX-currentX-iconSpace)
+	textlayout.DrawStringAnchored(dc, face, m.theme.Muted, preview, currentX, centerY, 0, 0.5)
+	currentX += measure(face, preview) + 5
+	dc.SetFontFace(m.face)
+
+	if data.ReplyHasAttachments {
+		drawImageGlyph(dc, currentX, centerY-replyIconHeight/2, m.theme.Muted)
+	}
+	return nil
+}
+
+// drawImageGlyph draws the small picture icon Discord puts after replies to
+// messages with attachments.
+func drawImageGlyph(dc *gg.Context, x, y float64, c color.Color) {
+	dc.SetColor(c)
+	dc.SetLineWidth(1.5)
+	dc.DrawRoundedRectangle(x, y, replyIconWidth, replyIconHeight, 2)
+	dc.Stroke()
+	dc.MoveTo(x+3, y+replyIconHeight-3)
+	dc.LineTo(x+8, y+6)
+	dc.LineTo(x+11, y+9)
+	dc.LineTo(x+13, y+7)
+	dc.LineTo(x+replyIconWidth-3, y+replyIconHeight-3)
+	dc.ClosePath()
+	dc.Fill()
+	dc.DrawCircle(x+13, y+4, 1.5)
+	dc.Fill()
+}
+
+// drawDeletedGlyph draws a crossed-out speech bubble centred at (cx, cy).
+func drawDeletedGlyph(dc *gg.Context, cx, cy float64, c color.Color) {
+	dc.SetColor(c)
+	dc.SetLineWidth(1.5)
+	dc.DrawRoundedRectangle(cx-7, cy-6, 14, 10, 3)
+	dc.MoveTo(cx-3, cy+4)
+	dc.LineTo(cx-5, cy+7)
+	dc.LineTo(cx+1, cy+4)
+	dc.Stroke()
+	dc.DrawLine(cx-8, cy-8, cx+8, cy+8)
+	dc.Stroke()
+}
@@ -0,0 +1,189 @@
+package skullboard
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strings"
+
+	"jasper/utils"
+)
+
+// Theme is the palette a message is drawn with.
+type Theme struct {
+	Background color.Color
+	// Text is message text, Header is usernames without a role color and
+	// embed titles, and Muted is timestamps, subtext and reply previews.
+	Text   color.Color
+	Header color.Color
+	Muted  color.Color
+
+	Mention       color.Color
+	MentionPill   color.Color
+	TimestampPill color.Color
+	Link          color.Color
+
+	CodeBackground color.Color
+	CodeBorder     color.Color
+	QuoteBar       color.Color
+	Spoiler        color.Color
+
+	EmbedBackground color.Color
+	EmbedBar        color.Color
+}
+
+var (
+	DarkTheme = Theme{
+		Background:      color.RGBA{R: 50, G: 51, B: 56, A: 255},
+		Text:            color.RGBA{R: 230, G: 230, B: 230, A: 255},
+		Header:          color.RGBA{R: 242, G: 243, B: 245, A: 255},
+		Muted:           color.RGBA{R: 148, G: 155, B: 164, A: 255},
+		Mention:         color.RGBA{R: 201, G: 205, B: 251, A: 255},
+		MentionPill:     color.NRGBA{R: 88, G: 101, B: 242, A: 77},
+		TimestampPill:   color.NRGBA{R: 78, G: 80, B: 88, A: 122},
+		Link:            color.RGBA{R: 0, G: 168, B: 252, A: 255},
+		CodeBackground:  color.RGBA{R: 43, G: 45, B: 49, A: 255},
+		CodeBorder:      color.RGBA{R: 30, G: 31, B: 34, A: 255},
+		QuoteBar:        color.RGBA{R: 78, G: 80, B: 88, A: 255},
+		Spoiler:         color.RGBA{R: 30, G: 31, B: 34, A: 255},
+		EmbedBackground: color.RGBA{R: 43, G: 45, B: 49, A: 255},
+		EmbedBar:        color.RGBA{R: 30, G: 31, B: 34, A: 255},
+	}
+
+	LightTheme = Theme{
+		Background:      color.RGBA{R: 255, G: 255, B: 255, A: 255},
+		Text:            color.RGBA{R: 49, G: 51, B: 56, A: 255},
+		Header:          color.RGBA{R: 6, G: 6, B: 7, A: 255},
+		Muted:           color.RGBA{R: 92, G: 94, B: 102, A: 255},
+		Mention:         color.RGBA{R: 80, G: 92, B: 220, A: 255},
+		MentionPill:     color.NRGBA{R: 88, G: 101, B: 242, A: 38},
+		TimestampPill:   color.NRGBA{R: 6, G: 6, B: 7, A: 20},
+		Link:            color.RGBA{R: 0, G: 108, B: 231, A: 255},
+		CodeBackground:  color.RGBA{R: 242, G: 243, B: 245, A: 255},
+		CodeBorder:      color.RGBA{R: 227, G: 229, B: 232, A: 255},
+		QuoteBar:        color.RGBA{R: 196, G: 201, B: 206, A: 255},
+		Spoiler:         color.RGBA{R: 227, G: 229, B: 232, A: 255},
+		EmbedBackground: color.RGBA{R: 242, G: 243, B: 245, A: 255},
+		EmbedBar:        color.RGBA{R: 227, G: 229, B: 232, A: 255},
+	}
+
+	AmoledTheme = Theme{
+		Background:      color.RGBA{R: 0, G: 0, B: 0, A: 255},
+		Text:            color.RGBA{R: 219, G: 222, B: 225, A: 255},
+		Header:          color.RGBA{R: 242, G: 243, B: 245, A: 255},
+		Muted:           color.RGBA{R: 148, G: 155, B: 164, A: 255},
+		Mention:         color.RGBA{R: 201, G: 205, B: 251, A: 255},
+		MentionPill:     color.NRGBA{R: 88, G: 101, B: 242, A: 77},
+		TimestampPill:   color.NRGBA{R: 78, G: 80, B: 88, A: 122},
+		Link:            color.RGBA{R: 0, G: 168, B: 252, A: 255},
+		CodeBackground:  color.RGBA{R: 17, G: 18, B: 20, A: 255},
+		CodeBorder:      color.RGBA{R: 30, G: 31, B: 34, A: 255},
+		QuoteBar:        color.RGBA{R: 78, G: 80, B: 88, A: 255},
+		Spoiler:         color.RGBA{R: 30, G: 31, B: 34, A: 255},
+		EmbedBackground: color.RGBA{R: 17, G: 18, B: 20, A: 255},
+		EmbedBar:        color.RGBA{R: 30, G: 31, B: 34, A: 255},
+	}
+
+	themes = map[string]Theme{
+		"dark":   DarkTheme,
+		"light":  LightTheme,
+		"amoled": AmoledTheme,
+	}
+)
+
+// ThemeByName returns a built-in theme. An empty name is the dark theme.
+func ThemeByName(name string) (Theme, error) {
+	if name == "" {
+		return DarkTheme, nil
+	}
+	theme, ok := themes[strings.ToLower(name)]
+	if !ok {
+		return Theme{}, fmt.Errorf("unknown theme %q, expected one of %s", name, strings.Join(ThemeNames(), ", "))
+	}
+	return theme, nil
+}
+
+func ThemeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Palette overrides colors of a theme with "#rrggbb" or "#rrggbbaa" values.
+// Empty fields keep the theme's color.
+type Palette struct {
+	Background      string `json:"background"`
+	Text            string `json:"text"`
+	Header          string `json:"header"`
+	Muted           string `json:"muted"`
+	Mention         string `json:"mention"`
+	MentionPill     string `json:"mentionPill"`
+	TimestampPill   string `json:"timestampPill"`
+	Link            string `json:"link"`
+	CodeBackground  string `json:"codeBackground"`
+	CodeBorder      string `json:"codeBorder"`
+	QuoteBar        string `json:"quoteBar"`
+	Spoiler         string `json:"spoiler"`
+	EmbedBackground string `json:"embedBackground"`
+	EmbedBar        string `json:"embedBar"`
+}
+
+// WithPalette returns the theme with the palette's colors applied on top.
+func (t Theme) WithPalette(p Palette) (Theme, error) {
+	overrides := []struct {
+		name  string
+		value string
+		dst   *color.Color
+	}{
+		{"background", p.Background, &t.Background},
+		{"text", p.Text, &t.Text},
+		{"header", p.Header, &t.Header},
+		{"muted", p.Muted, &t.Muted},
+		{"mention", p.Mention, &t.Mention},
+		{"mentionPill", p.MentionPill, &t.MentionPill},
+		{"timestampPill", p.TimestampPill, &t.TimestampPill},
+		{"link", p.Link, &t.Link},
+		{"codeBackground", p.CodeBackground, &t.CodeBackground},
+		{"codeBorder", p.CodeBorder, &t.CodeBorder},
+		{"quoteBar", p.QuoteBar, &t.QuoteBar},
+		{"spoiler", p.Spoiler, &t.Spoiler},
+		{"embedBackground", p.EmbedBackground, &t.EmbedBackground},
+		{"embedBar", p.EmbedBar, &t.EmbedBar},
+	}
+	for _, o := range overrides {
+		if o.value == "" {
+			continue
+		}
+		c, err := utils.ParseHexColor(o.value)
+		if err != nil {
+			return Theme{}, fmt.Errorf("invalid %s color: %w", o.name, err)
+		}
+		*o.dst = c
+	}
+	return t, nil
+}
+
+// orDefault returns the dark theme for a zero Theme, so MessageData works
+// without one.
+func (t Theme) orDefault() Theme {
+	if t.Background == nil {
+		return DarkTheme
+	}
+	return t
+}
+
+// textColor parses a username color, falling back to the theme's header color
+// for users without a colored role.
+func (t Theme) textColor(hex string) color.Color {
+	if hex == "" || strings.EqualFold(hex, "#000000") {
+		return t.Header
+	}
+	c, err := utils.ParseHexColor(hex)
+	if err != nil {
+		return t.Header
+	}
+	return c
+}
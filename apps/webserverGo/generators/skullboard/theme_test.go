@@ -0,0 +1,67 @@
+package skullboard
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"jasper/golden"
+)
+
+// avatarServer serves a gradient PNG as every avatar and image.
+func avatarServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	avatar := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := range 64 {
+		for x := range 64 {
+			avatar.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: 160, A: 255})
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		png.Encode(w, avatar)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestThemes renders a message using most of the palette in each theme and
+// compares it with testdata/theme-<name>.png.
+func TestThemes(t *testing.T) {
+	server := avatarServer(t)
+	for _, name := range ThemeNames() {
+		t.Run(name, func(t *testing.T) {
+			theme, err := ThemeByName(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := GenerateDiscordMessage(context.Background(), MessageData{
+				ReplyAvatar:   server.URL + "/reply.png",
+				ReplyUsername: "bob",
+				ReplyContent:  "what did I miss?",
+				Avatar:        server.URL + "/avatar.png",
+				Username:      "alice",
+				UsernameColor: "#e67e22",
+				Timestamp:     "Today at 4:20 PM",
+				Content:       "hey <@1>, **bold** *italic* `code` ||spoiler|| https://example.com\n> quoted\n```go\nfmt.Println(\"hi\")\n```",
+				Mentions:      []Mention{{ID: "1", Name: "bob"}},
+				Embeds: []Embed{{
+					Title:       "Embed title",
+					Description: "Embed description",
+					Color:       0x5865f2,
+					Fields:      []EmbedField{{Name: "Field", Value: "value", Inline: true}},
+					Footer:      &EmbedFooter{Text: "footer"},
+				}},
+				Theme: theme,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden.Assert(t, "theme-"+name, img)
+		})
+	}
+}
@@ -1,67 +1,170 @@
 package speechbubble
 
 import (
+	"context"
 	"image"
+	"image/color"
 	"log/slog"
+	"math"
 
 	"github.com/fogleman/gg"
+	"go.opentelemetry.io/otel/attribute"
 
+	"jasper/tracing"
 	"jasper/utils"
 )
 
-func Flip(img image.Image) image.Image {
-	bounds := img.Bounds()
-	width := bounds.Dx()
-	height := bounds.Dy()
+const (
+	TailLeft   = "left"
+	TailRight  = "right"
+	TailCenter = "center"
 
-	dc := gg.NewContext(width, height)
-	dc.Scale(1, -1)
-	dc.Translate(0, -float64(height))
-	dc.DrawImage(img, 0, 0)
-	return dc.Image()
-}
-
-func ScaleBubble(img image.Image, targetWidth int) image.Image {
-	originalBounds := img.Bounds()
-	originalWidth := originalBounds.Dx()
-	originalHeight := originalBounds.Dy()
+	// DefaultHeight is the height of the bubble at its middle, as a share of
+	// the image height.
+	DefaultHeight = 0.1
+)
 
-	scale := float64(targetWidth) / float64(originalWidth)
-	targetHeight := int(float64(originalHeight) * scale)
+const (
+	// The bubble's edge curves up to this share of its height at the sides.
+	edgeHeight = 0.35
+	// The tail reaches this many times the bubble height below the image
+	// edge, but no further than tailMaxDepth of the image.
+	tailDepth    = 2.6
+	tailMaxDepth = 0.9
+	// tailBase is the width where the tail meets the bubble and tailLean how
+	// far its tip leans toward the middle, as shares of the image width.
+	tailBase = 0.06
+	tailLean = 0.14
+)
 
-	dc := gg.NewContext(targetWidth, targetHeight)
-	dc.Scale(scale, scale)
-	dc.DrawImage(img, 0, 0)
-	return dc.Image()
+// Bubble is the shape and look of a speech bubble.
+type Bubble struct {
+	// Position is the image edge the bubble hangs from, "top" or "bottom".
+	Position string
+	// Tail is the side the tail hangs from, TailLeft, TailRight or TailCenter.
+	// Empty is TailLeft.
+	Tail string
+	// TailX moves the tip of the tail to this share of the image width. Nil
+	// leans it a little toward the middle.
+	TailX *float64
+	// Height is the height of the bubble as a share of the image height, or 0
+	// for DefaultHeight.
+	Height float64
+	// Color fills the bubble. Nil is white.
+	Color color.Color
+	// Cutout erases the bubble from the image instead of painting it, leaving
+	// it transparent.
+	Cutout bool
 }
 
-func GenImage(URL string, position string) (image.Image, error) {
-	img, err := utils.LoadImageFromURL(URL)
+func GenImage(ctx context.Context, URL string, bubble Bubble) (image.Image, error) {
+	ctx, span := tracing.Start(ctx, "speechbubble.GenImage", attribute.Bool("speechbubble.cutout", bubble.Cutout))
+	defer span.End()
+
+	img, err := utils.LoadImageFromURL(ctx, URL)
 	if err != nil {
 		slog.Error("Failed to load image from URL", "url", URL, "error", err)
-		return nil, err
+		return nil, tracing.RecordError(span, err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, tracing.RecordError(span, err)
 	}
 
+	_, renderSpan := tracing.Start(ctx, "speechbubble.render")
+	defer renderSpan.End()
 	imgWidth := img.Bounds().Dx()
 	imgHeight := img.Bounds().Dy()
+	dc := gg.NewContext(imgWidth, imgHeight)
 
-	bubbleImg, err := gg.LoadImage("./generators/speechbubble/speechbubble.png")
-	if err != nil {
-		slog.Error("Failed to load speech bubble image", "error", err)
-		return nil, err
+	if bubble.Cutout {
+		// Draw the image only where the bubble is not, through the inverse of
+		// a mask of the bubble.
+		maskDC := gg.NewContext(imgWidth, imgHeight)
+		bubble.path(maskDC, float64(imgWidth), float64(imgHeight))
+		maskDC.Fill()
+		mask := maskDC.AsMask()
+		for i, a := range mask.Pix {
+			mask.Pix[i] = 255 - a
+		}
+		if err := dc.SetMask(mask); err != nil {
+			return nil, tracing.RecordError(span, err)
+		}
+		dc.DrawImage(img, 0, 0)
+		return dc.Image(), nil
 	}
 
-	dc := gg.NewContext(imgWidth, imgHeight)
 	dc.DrawImage(img, 0, 0)
+	bubble.path(dc, float64(imgWidth), float64(imgHeight))
+	fill := bubble.Color
+	if fill == nil {
+		fill = color.White
+	}
+	dc.SetColor(fill)
+	dc.FillPreserve()
+	dc.SetColor(color.Black)
+	dc.SetLineWidth(max(2, float64(imgWidth)*0.01))
+	dc.SetLineJoin(gg.LineJoinRound)
+	dc.Stroke()
+	return dc.Image(), nil
+}
 
-	bubbleImg = ScaleBubble(bubbleImg, imgWidth)
-	bubbleHeight := bubbleImg.Bounds().Dy()
+// path adds the outline of the bubble to dc's path: the image edge, a curved
+// lower edge that sags deepest in the middle, and the tail. Its sides and top
+// lie outside the image, so only the lower edge shows when stroked.
+func (b Bubble) path(dc *gg.Context, width, height float64) {
+	if b.Position == "bottom" {
+		dc.Translate(0, height)
+		dc.Scale(1, -1)
+		defer dc.Identity()
+	}
 
-	if position == "top" {
-		dc.DrawImage(bubbleImg, 0, 0)
-	} else {
-		y := imgHeight - bubbleHeight
-		dc.DrawImage(Flip(bubbleImg), 0, y)
+	bodyHeight := height * DefaultHeight
+	if b.Height > 0 {
+		bodyHeight = height * b.Height
 	}
-	return dc.Image(), nil
+	edge := bodyHeight * edgeHeight
+	// The lower edge is a quadratic curve from one side to the other, which is
+	// a parabola since its control point is in the middle.
+	curve := func(x float64) float64 {
+		t := x / width
+		return edge*(1-t)*(1-t) + 2*t*(1-t)*(2*bodyHeight-edge) + edge*t*t
+	}
+
+	baseX, lean := width*0.13, tailLean
+	switch b.Tail {
+	case TailRight:
+		baseX, lean = width*0.87, -tailLean
+	case TailCenter:
+		baseX, lean = width/2, 0
+	}
+	tipX := baseX + lean*width
+	if b.TailX != nil {
+		tipX = *b.TailX * width
+	}
+	tipY := math.Min(bodyHeight*tailDepth, height*tailMaxDepth)
+	base0, base1 := baseX-width*tailBase/2, baseX+width*tailBase/2
+
+	// The outside corners sit past the image so the stroke does not show there.
+	over := width * 0.05
+	dc.MoveTo(-over, -over)
+	dc.LineTo(-over, curve(0))
+	const steps = 64
+	tail := false
+	for i := 0; i <= steps; i++ {
+		x := width * float64(i) / steps
+		if !tail && x >= base0 {
+			dc.LineTo(base0, curve(base0))
+			dc.LineTo(tipX, tipY)
+			dc.LineTo(base1, curve(base1))
+			tail = true
+		}
+		if x > base0 && x < base1 {
+			continue
+		}
+		dc.LineTo(x, curve(x))
+	}
+	dc.LineTo(width+over, curve(width))
+	dc.LineTo(width+over, -over)
+	dc.ClosePath()
 }
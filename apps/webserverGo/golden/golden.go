@@ -0,0 +1,103 @@
+// Package golden compares images rendered in tests with reference PNGs in the
+// test's testdata directory. Run the tests with UPDATE_GOLDEN=1 to write the
+// references from the current renders.
+package golden
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tolerance is how far each channel of a pixel may be from the reference, out
+// of 255, so small changes in antialiasing don't fail the test.
+const Tolerance = 16
+
+// Assert fails t unless img matches testdata/name.png within Tolerance. A
+// mismatching render is written beside the reference as name.actual.png.
+func Assert(t testing.TB, name string, img image.Image) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".png")
+	actual := filepath.Join("testdata", name+".actual.png")
+
+	if os.Getenv("UPDATE_GOLDEN") != "" {
+		if err := write(path, img); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(actual)
+		return
+	}
+
+	want, err := read(path)
+	if err != nil {
+		t.Fatalf("%v (run with UPDATE_GOLDEN=1 to create it)", err)
+	}
+	bad, first := diff(want, img)
+	if bad == 0 {
+		os.Remove(actual)
+		return
+	}
+	if err := write(actual, img); err != nil {
+		t.Error(err)
+	}
+	if first == nil {
+		t.Fatalf("%s: image is %v, want %v; see %s", name, img.Bounds().Size(), want.Bounds().Size(), actual)
+	}
+	t.Fatalf("%s: %d pixels differ from the reference, the first at %v; see %s", name, bad, *first, actual)
+}
+
+// diff counts the pixels of got further than Tolerance from want and returns
+// the first of them, or no point if the sizes differ.
+func diff(want, got image.Image) (int, *image.Point) {
+	wb, gb := want.Bounds(), got.Bounds()
+	if wb.Size() != gb.Size() {
+		return 1, nil
+	}
+	var first *image.Point
+	bad := 0
+	for y := 0; y < wb.Dy(); y++ {
+		for x := 0; x < wb.Dx(); x++ {
+			if !near(want.At(wb.Min.X+x, wb.Min.Y+y), got.At(gb.Min.X+x, gb.Min.Y+y)) {
+				if first == nil {
+					first = &image.Point{X: x, Y: y}
+				}
+				bad++
+			}
+		}
+	}
+	return bad, first
+}
+
+func near(a, b color.Color) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	d := func(x, y uint32) bool { return max(x, y)-min(x, y) <= Tolerance<<8 }
+	return d(ar, br) && d(ag, bg) && d(ab, bb) && d(aa, ba)
+}
+
+func read(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+func write(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,9 +10,12 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 
+	"jasper/assets"
 	"jasper/middleware"
 	routes_fun "jasper/routes/fun"
+	routes_health "jasper/routes/health"
 	routes_yt "jasper/routes/youtube"
+	"jasper/tracing"
 )
 
 func main() {
@@ -20,17 +24,39 @@ func main() {
 		log.Println("No .env file found or failed to load")
 	}
 
+	if dir := os.Getenv("JASPER_ASSETS_DIR"); dir != "" {
+		assets.SetOverrideDir(dir)
+		log.Println("Loading asset overrides from " + dir)
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	r := mux.NewRouter()
-	r.Use(middleware.AuthMiddleware)
-	r.Use(middleware.LoggingMiddleware)
+	r.Use(middleware.TracingMiddleware)
+
+	// Probes stay outside the authenticated router so orchestrators can reach them.
+	r.HandleFunc("/healthz", routes_health.LivenessHandler).Methods("GET")
+	r.HandleFunc("/readyz", routes_health.ReadinessHandler).Methods("GET")
+	r.HandleFunc("/version", routes_health.VersionHandler).Methods("GET")
+
+	api := r.PathPrefix("/").Subrouter()
+	api.Use(middleware.AuthMiddleware)
+	api.Use(middleware.LoggingMiddleware)
+	api.Use(middleware.WarningsMiddleware)
+
+	api.HandleFunc("/youtube/{id}", routes_yt.ChannelInfoHandler).Methods("GET")
+	api.HandleFunc("/youtube/{id}/subscribers", routes_yt.SubscriberCountHandler).Methods("GET")
 
-	r.HandleFunc("/youtube/{id}", routes_yt.ChannelInfoHandler).Methods("GET")
-	r.HandleFunc("/youtube/{id}/subscribers", routes_yt.SubscriberCountHandler).Methods("GET")
+	api.HandleFunc("/fun", routes_fun.IndexHandler).Methods("GET")
+	api.HandleFunc("/fun/meme/templates", routes_fun.MemeTemplatesHandler).Methods("GET")
 
-	r.HandleFunc("/fun/caption", routes_fun.CaptionHandler).Methods("POST")
-	r.HandleFunc("/fun/meme", routes_fun.MemeHandler).Methods("POST")
-	r.HandleFunc("/fun/speechbubble", routes_fun.BubbleHandler).Methods("POST")
-	r.HandleFunc("/fun/skullboard", routes_fun.SkullboardHandler).Methods("POST")
+	fun := api.PathPrefix("/fun").Subrouter()
+	fun.Use(middleware.RenderTimeoutMiddleware)
+	fun.HandleFunc("/{name}", routes_fun.GenerateHandler).Methods("POST")
 
 	fmt.Println("Server is running on " + os.Getenv("PORT"))
 	log.Fatal(http.ListenAndServe(os.Getenv("PORT"), r))
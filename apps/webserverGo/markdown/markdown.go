@@ -0,0 +1,299 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var langRegex = regexp.MustCompile(`^[\w+#.-]+$`)
+
+type BlockKind int
+
+const (
+	Paragraph BlockKind = iota
+	Heading
+	Subtext
+	CodeBlock
+)
+
+// Block is a single line of a message, or a whole fenced code block.
+type Block struct {
+	Kind BlockKind
+
+	// Level is 1 to 3 for headings.
+	Level int
+
+	// Quote is set for lines inside a "> " or ">>> " quote.
+	Quote bool
+
+	// Spans hold the styled text of every kind but code blocks, which keep
+	// their raw text in Code and the optional language in Lang.
+	Spans []Span
+	Code  string
+	Lang  string
+}
+
+// Style is a set of inline formatting flags.
+type Style uint8
+
+const (
+	Bold Style = 1 << iota
+	Italic
+	Underline
+	Strike
+	Code
+	Spoiler
+)
+
+func (s Style) Has(flag Style) bool {
+	return s&flag != 0
+}
+
+// Span is a run of text with a single style.
+type Span struct {
+	Text  string
+	Style Style
+}
+
+// marker is an inline delimiter, tried in order so that "**" wins over "*".
+type marker struct {
+	delim string
+	style Style
+}
+
+var markers = []marker{
+	{"**", Bold},
+	{"__", Underline},
+	{"~~", Strike},
+	{"||", Spoiler},
+	{"*", Italic},
+	{"_", Italic},
+}
+
+// Parse splits Discord-flavored markdown into blocks. Anything that does not
+// form valid markup, such as an unclosed "**", is kept as literal text the way
+// the Discord client shows it.
+func Parse(content string) []Block {
+	var blocks []Block
+	quoteRest := false
+	rest := content
+
+	for {
+		line, next, more := strings.Cut(rest, "\n")
+
+		quote := quoteRest
+		if !quote {
+			if after, ok := strings.CutPrefix(line, ">>> "); ok {
+				// ">>> " quotes everything up to the end of the message.
+				quoteRest, quote, line = true, true, after
+			} else if after, ok := strings.CutPrefix(line, "> "); ok {
+				quote, line = true, after
+			}
+		}
+
+		if i := strings.Index(line, "```"); i >= 0 {
+			// The fence usually closes on a later line, so look for it in the
+			// rest of the message rather than just this line.
+			body := line[i+3:]
+			if more {
+				body += "\n" + next
+			}
+			if j := strings.Index(body, "```"); j > 0 {
+				if before := line[:i]; strings.TrimSpace(before) != "" {
+					blocks = append(blocks, lineBlock(before, quote))
+				}
+				blocks = append(blocks, codeBlock(body[:j], quote))
+
+				rest = strings.TrimPrefix(strings.TrimLeft(body[j+3:], " "), "\n")
+				if rest == "" {
+					break
+				}
+				continue
+			}
+		}
+
+		blocks = append(blocks, lineBlock(line, quote))
+		if !more {
+			break
+		}
+		rest = next
+	}
+	return blocks
+}
+
+func lineBlock(line string, quote bool) Block {
+	block := Block{Kind: Paragraph, Quote: quote}
+	switch {
+	case strings.HasPrefix(line, "-# "):
+		block.Kind = Subtext
+		line = line[3:]
+	case strings.HasPrefix(line, "### "):
+		block.Kind, block.Level = Heading, 3
+		line = line[4:]
+	case strings.HasPrefix(line, "## "):
+		block.Kind, block.Level = Heading, 2
+		line = line[3:]
+	case strings.HasPrefix(line, "# "):
+		block.Kind, block.Level = Heading, 1
+		line = line[2:]
+	}
+	block.Spans = ParseInline(line)
+	return block
+}
+
+// codeBlock builds a block from the text between two fences. A first line made
+// of a single word is the language, as in ```go.
+func codeBlock(raw string, quote bool) Block {
+	block := Block{Kind: CodeBlock, Quote: quote}
+	if lang, code, ok := strings.Cut(raw, "\n"); ok && langRegex.MatchString(lang) {
+		block.Lang, raw = lang, code
+	}
+	block.Code = strings.TrimSuffix(strings.TrimPrefix(raw, "\n"), "\n")
+	return block
+}
+
+// ParseInline parses bold, italic, underline, strikethrough, inline code and
+// spoilers. Markers nest, so "***a***" is bold and italic.
+func ParseInline(s string) []Span {
+	return parseInline(s, 0)
+}
+
+func parseInline(s string, style Style) []Span {
+	var spans []Span
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			spans = appendSpan(spans, Span{Text: text.String(), Style: style})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		if s[i] == '\\' && i+1 < len(s) && isEscapable(s[i+1]) {
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+		}
+
+		if s[i] == '`' {
+			delim := "`"
+			if strings.HasPrefix(s[i:], "``") {
+				delim = "``"
+			}
+			if j := strings.Index(s[i+len(delim):], delim); j > 0 {
+				flush()
+				code := s[i+len(delim) : i+len(delim)+j]
+				spans = appendSpan(spans, Span{Text: code, Style: style | Code})
+				i += len(delim)*2 + j
+				continue
+			}
+		}
+
+		matched := false
+		for _, m := range markers {
+			if !strings.HasPrefix(s[i:], m.delim) {
+				continue
+			}
+			if j := findClose(s, i, m.delim); j >= 0 {
+				flush()
+				for _, span := range parseInline(s[i+len(m.delim):j], style|m.style) {
+					spans = appendSpan(spans, span)
+				}
+				i = j + len(m.delim)
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+
+		text.WriteByte(s[i])
+		i++
+	}
+	flush()
+	return spans
+}
+
+// findClose returns the index of the delimiter closing the one at open, or -1.
+func findClose(s string, open int, delim string) int {
+	from := open + len(delim)
+	if from >= len(s) {
+		return -1
+	}
+	switch delim {
+	case "*":
+		// "* " starts a list item rather than italics.
+		if s[from] == ' ' {
+			return -1
+		}
+	case "_":
+		// Underscores inside words, as in snake_case, are not italics.
+		if open > 0 && isWordByte(s[open-1]) {
+			return -1
+		}
+	}
+
+	for k := from; k < len(s); {
+		j := strings.Index(s[k:], delim)
+		if j < 0 {
+			return -1
+		}
+		j += k
+		if len(delim) == 1 && j+1 < len(s) && s[j+1] == delim[0] {
+			// A "**" or "__" pair inside italics is nested markup, not the
+			// end of the italics.
+			if end := findClose(s, j, delim+delim); end >= 0 {
+				k = end + 2
+				continue
+			}
+		}
+		if len(delim) == 2 {
+			// A longer run closes at its end, so "***a***" leaves "*a*" inside.
+			for j+2 < len(s) && s[j+2] == delim[0] {
+				j++
+			}
+		}
+		if j > from && validClose(s, j, delim) {
+			return j
+		}
+		k = j + len(delim)
+	}
+	return -1
+}
+
+func validClose(s string, j int, delim string) bool {
+	switch delim {
+	case "*":
+		return s[j-1] != ' '
+	case "_":
+		return j+1 >= len(s) || !isWordByte(s[j+1])
+	}
+	return true
+}
+
+func appendSpan(spans []Span, span Span) []Span {
+	if n := len(spans); n > 0 && spans[n-1].Style == span.Style {
+		spans[n-1].Text += span.Text
+		return spans
+	}
+	return append(spans, span)
+}
+
+func isEscapable(c byte) bool {
+	return c < 0x80 && (unicode.IsPunct(rune(c)) || unicode.IsSymbol(rune(c)))
+}
+
+func isWordByte(c byte) bool {
+	return c >= 0x80 || c == '_' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+// PlainText returns the text of the spans without any markup.
+func PlainText(spans []Span) string {
+	var b strings.Builder
+	for _, span := range spans {
+		b.WriteString(span.Text)
+	}
+	return b.String()
+}
@@ -0,0 +1,118 @@
+package markdown
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseInline(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []Span
+	}{
+		{"plain", "hello", []Span{{"hello", 0}}},
+		{"bold", "**a**", []Span{{"a", Bold}}},
+		{"italic star", "*a*", []Span{{"a", Italic}}},
+		{"italic underscore", "_a_", []Span{{"a", Italic}}},
+		{"underline", "__a__", []Span{{"a", Underline}}},
+		{"strike", "~~a~~", []Span{{"a", Strike}}},
+		{"spoiler", "||a||", []Span{{"a", Spoiler}}},
+		{"bold italic", "***a***", []Span{{"a", Bold | Italic}}},
+		{"underline italic", "___a___", []Span{{"a", Underline | Italic}}},
+		{"italic in bold", "**a *b* c**", []Span{{"a ", Bold}, {"b", Bold | Italic}, {" c", Bold}}},
+		{"bold in italic", "*a **b** c*", []Span{{"a ", Italic}, {"b", Bold | Italic}, {" c", Italic}}},
+		{"underline in italic", "_a __b__ c_", []Span{{"a ", Italic}, {"b", Underline | Italic}, {" c", Italic}}},
+		{"spoiler around bold", "||**a**||", []Span{{"a", Spoiler | Bold}}},
+		{"mixed on a line", "a **b** _c_ d", []Span{{"a ", 0}, {"b", Bold}, {" ", 0}, {"c", Italic}, {" d", 0}}},
+		{"unclosed bold", "**a", []Span{{"**a", 0}}},
+		{"unclosed spoiler", "||a", []Span{{"||a", 0}}},
+		{"star list item", "* a*", []Span{{"* a*", 0}}},
+		{"star before space does not close", "*a *", []Span{{"*a *", 0}}},
+		{"snake case", "snake_case_name", []Span{{"snake_case_name", 0}}},
+		{"inline code", "`**a**`", []Span{{"**a**", Code}}},
+		{"double backtick code", "``a ` b``", []Span{{"a ` b", Code}}},
+		{"code in bold", "**a `b` c**", []Span{{"a ", Bold}, {"b", Bold | Code}, {" c", Bold}}},
+		{"unclosed code", "`a", []Span{{"`a", 0}}},
+		{"escaped star", `\*a\*`, []Span{{"*a*", 0}}},
+		{"escaped bold", `\*\*a\*\*`, []Span{{"**a**", 0}}},
+		{"escaped spoiler", `\||a||`, []Span{{"||a||", 0}}},
+		{"escaped backtick", "\\`a`", []Span{{"`a`", 0}}},
+		{"backslash before a letter", `a\b`, []Span{{`a\b`, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseInline(tt.in); !slices.Equal(got, tt.want) {
+				t.Errorf("ParseInline(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []Block
+	}{
+		{"lines", "a\nb", []Block{
+			{Kind: Paragraph, Spans: []Span{{"a", 0}}},
+			{Kind: Paragraph, Spans: []Span{{"b", 0}}},
+		}},
+		{"headings and subtext", "# a\n## b\n### c\n-# d\n#### e", []Block{
+			{Kind: Heading, Level: 1, Spans: []Span{{"a", 0}}},
+			{Kind: Heading, Level: 2, Spans: []Span{{"b", 0}}},
+			{Kind: Heading, Level: 3, Spans: []Span{{"c", 0}}},
+			{Kind: Subtext, Spans: []Span{{"d", 0}}},
+			{Kind: Paragraph, Spans: []Span{{"#### e", 0}}},
+		}},
+		{"quote", "> **a**\nb", []Block{
+			{Kind: Paragraph, Quote: true, Spans: []Span{{"a", Bold}}},
+			{Kind: Paragraph, Spans: []Span{{"b", 0}}},
+		}},
+		{"quote to the end", ">>> a\nb", []Block{
+			{Kind: Paragraph, Quote: true, Spans: []Span{{"a", 0}}},
+			{Kind: Paragraph, Quote: true, Spans: []Span{{"b", 0}}},
+		}},
+		{"code block", "```go\nx := **y**\n```", []Block{
+			{Kind: CodeBlock, Lang: "go", Code: "x := **y**"},
+		}},
+		{"code block without a language", "```\n# not a heading\n> nor a quote\n```", []Block{
+			{Kind: CodeBlock, Code: "# not a heading\n> nor a quote"},
+		}},
+		{"code block on one line", "```a *b*```", []Block{
+			{Kind: CodeBlock, Code: "a *b*"},
+		}},
+		{"text around a code block", "see ```x``` **after**", []Block{
+			{Kind: Paragraph, Spans: []Span{{"see ", 0}}},
+			{Kind: CodeBlock, Code: "x"},
+			{Kind: Paragraph, Spans: []Span{{"after", Bold}}},
+		}},
+		{"quoted code block", "> ```\ncode\n```", []Block{
+			{Kind: CodeBlock, Quote: true, Code: "code"},
+		}},
+		{"unclosed fence", "```go\n**a**", []Block{
+			{Kind: Paragraph, Spans: []Span{{"```go", 0}}},
+			{Kind: Paragraph, Spans: []Span{{"a", Bold}}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.in)
+			if !slices.EqualFunc(got, tt.want, equalBlocks) {
+				t.Errorf("Parse(%q) =\n%+v\nwant\n%+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func equalBlocks(a, b Block) bool {
+	return a.Kind == b.Kind && a.Level == b.Level && a.Quote == b.Quote &&
+		a.Code == b.Code && a.Lang == b.Lang && slices.Equal(a.Spans, b.Spans)
+}
+
+func TestPlainText(t *testing.T) {
+	if got := PlainText(ParseInline("**a** *b* `c` ||d||")); got != "a b c d" {
+		t.Errorf("PlainText = %q, want %q", got, "a b c d")
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// DefaultRenderTimeout bounds a render when RENDER_TIMEOUT is not set.
+const DefaultRenderTimeout = 30 * time.Second
+
+// renderTimeout returns the timeout for a route such as /fun/conversation or
+// a generator name such as conversation, read from RENDER_TIMEOUT_CONVERSATION,
+// then RENDER_TIMEOUT, then the default.
+func renderTimeout(route string) time.Duration {
+	name := strings.ToUpper(strings.ReplaceAll(route[strings.LastIndex(route, "/")+1:], "-", "_"))
+	for _, key := range []string{"RENDER_TIMEOUT_" + name, "RENDER_TIMEOUT"} {
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			slog.Error("Invalid render timeout, ignoring it", "variable", key, "value", value)
+			continue
+		}
+		return timeout
+	}
+	return DefaultRenderTimeout
+}
+
+// RenderTimeoutMiddleware cancels the request context once the route's render
+// timeout passes, which aborts downloads and skips the remaining draw stages.
+func RenderTimeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if name, ok := mux.Vars(r)["name"]; ok {
+			route = name
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), renderTimeout(route))
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
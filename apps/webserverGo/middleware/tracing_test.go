@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"jasper/tracing"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown, err := tracing.Init(context.Background(), tracing.WithExporter(exporter), tracing.WithSyncer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { shutdown(context.Background()) })
+
+	r := mux.NewRouter()
+	r.Use(TracingMiddleware)
+	r.HandleFunc("/fun/{name}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracing.Start(r.Context(), "render")
+		defer span.End()
+		if mux.Vars(r)["name"] == "broken" {
+			tracing.RecordError(span, errors.New("render failed"))
+			http.Error(w, "Failed to render", http.StatusInternalServerError)
+		}
+	}).Methods(http.MethodPost)
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tests := []struct {
+		path   string
+		status int
+		code   codes.Code
+	}{
+		{"/fun/meme", http.StatusOK, codes.Unset},
+		{"/fun/broken", http.StatusInternalServerError, codes.Error},
+	}
+	for _, tt := range tests {
+		exporter.Reset()
+		req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+		req.Header.Set("traceparent", traceparent)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := exporter.GetSpans()
+		if len(spans) != 2 {
+			t.Fatalf("%s: got %d spans, want the render and server spans", tt.path, len(spans))
+		}
+		render, server := spans[0], spans[1]
+
+		if server.Name != "POST /fun/{name}" {
+			t.Errorf("%s: span name = %q", tt.path, server.Name)
+		}
+		if server.SpanKind != trace.SpanKindServer {
+			t.Errorf("%s: span kind = %v", tt.path, server.SpanKind)
+		}
+		if got := server.Parent.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("%s: parent trace = %s, want the traceparent's", tt.path, got)
+		}
+		if render.Parent.SpanID() != server.SpanContext.SpanID() {
+			t.Errorf("%s: render span is not a child of the server span", tt.path)
+		}
+
+		want := map[attribute.Key]attribute.Value{
+			"http.request.method":       attribute.StringValue("POST"),
+			"http.route":                attribute.StringValue("/fun/{name}"),
+			"url.path":                  attribute.StringValue(tt.path),
+			"http.response.status_code": attribute.IntValue(tt.status),
+		}
+		got := make(map[attribute.Key]attribute.Value)
+		for _, kv := range server.Attributes {
+			got[kv.Key] = kv.Value
+		}
+		for key, value := range want {
+			if got[key] != value {
+				t.Errorf("%s: %s = %v, want %v", tt.path, key, got[key].Emit(), value.Emit())
+			}
+		}
+
+		if server.Status.Code != tt.code {
+			t.Errorf("%s: server status = %v, want %v", tt.path, server.Status.Code, tt.code)
+		}
+		if tt.code == codes.Error {
+			if render.Status.Code != codes.Error || render.Status.Description != "render failed" {
+				t.Errorf("%s: render status = %+v", tt.path, render.Status)
+			}
+			if len(render.Events) != 1 || render.Events[0].Name != "exception" {
+				t.Errorf("%s: render events = %+v, want the recorded error", tt.path, render.Events)
+			}
+		}
+	}
+}
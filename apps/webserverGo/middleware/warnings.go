@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+
+	"jasper/warnings"
+)
+
+// WarningsHeader lists the elements a generator had to degrade, one value per
+// warning.
+const WarningsHeader = "X-Jasper-Warnings"
+
+type warningsWriter struct {
+	http.ResponseWriter
+	collector   *warnings.Collector
+	wroteHeader bool
+}
+
+func (w *warningsWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		for _, warning := range w.collector.Warnings() {
+			w.Header().Add(WarningsHeader, warning)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *warningsWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// WarningsMiddleware collects the warnings raised while handling a request and
+// sends them in the WarningsHeader header. Handlers render before writing, so
+// every warning is known by the time the headers go out.
+func WarningsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, collector := warnings.NewContext(r.Context())
+		next.ServeHTTP(&warningsWriter{ResponseWriter: w, collector: collector}, r.WithContext(ctx))
+	})
+}
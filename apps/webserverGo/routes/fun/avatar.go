@@ -0,0 +1,89 @@
+package fun
+
+import (
+	"context"
+	"errors"
+	"image"
+
+	"jasper/generators"
+	"jasper/generators/avatar"
+	"jasper/utils"
+)
+
+type avatarParams struct {
+	Avatar string `json:"avatar" required:"true" desc:"Avatar URL"`
+	Text   string `json:"text" desc:"Optional text for the overlay"`
+}
+
+func (p *avatarParams) validate() error {
+	if p.Avatar == "" {
+		return errors.New("Avatar URL cannot be empty")
+	}
+	return nil
+}
+
+type wantedGenerator struct{}
+
+func (wantedGenerator) Description() string {
+	return "The avatar on a wanted poster, with text as the name"
+}
+
+func (wantedGenerator) Validate(p *avatarParams) error { return p.validate() }
+
+func (wantedGenerator) Render(ctx context.Context, p *avatarParams) (image.Image, error) {
+	return avatar.Wanted(ctx, p.Avatar, p.Text)
+}
+
+type jailGenerator struct{}
+
+func (jailGenerator) Description() string {
+	return "The avatar behind jail bars, with text on a placard"
+}
+
+func (jailGenerator) Validate(p *avatarParams) error { return p.validate() }
+
+func (jailGenerator) Render(ctx context.Context, p *avatarParams) (image.Image, error) {
+	return avatar.Jail(ctx, p.Avatar, p.Text)
+}
+
+type triggeredGenerator struct{}
+
+func (triggeredGenerator) Description() string {
+	return "An animated GIF of the avatar shaking, tinted red, over a TRIGGERED banner or text"
+}
+
+func (triggeredGenerator) Validate(p *avatarParams) error { return p.validate() }
+
+func (triggeredGenerator) Render(ctx context.Context, p *avatarParams) (image.Image, error) {
+	frames, err := avatar.Triggered(ctx, p.Avatar, p.Text)
+	if err != nil {
+		return nil, err
+	}
+	return &generators.GIF{Frames: frames, Delay: avatar.TriggeredDelay}, nil
+}
+
+type frameParams struct {
+	avatarParams
+	Ring string `json:"ring" desc:"Ring style: gold (the default), rainbow or a #rrggbb color"`
+}
+
+type frameGenerator struct{}
+
+func (frameGenerator) Description() string {
+	return "The avatar in a round frame, with text on a ribbon"
+}
+
+func (frameGenerator) Validate(p *frameParams) error {
+	switch p.Ring {
+	case "", avatar.FrameGold, avatar.FrameRainbow:
+	default:
+		if _, err := utils.ParseHexColor(p.Ring); err != nil {
+			return errors.New("Invalid ring, must be 'gold', 'rainbow' or a #rrggbb color")
+		}
+	}
+	return p.validate()
+}
+
+func (frameGenerator) Render(ctx context.Context, p *frameParams) (image.Image, error) {
+	return avatar.Frame(ctx, p.Avatar, p.Ring, p.Text)
+}
@@ -1,49 +1,61 @@
 package fun
 
 import (
-	"encoding/json"
-	"image/png"
-	"net/http"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"slices"
+	"strings"
 
 	"jasper/generators/fun"
+	"jasper/textlayout"
 )
 
-func CaptionHandler(w http.ResponseWriter, r *http.Request) {
-	var requestBody struct {
-		FontSize float64 `json:"fontsize"`
-		Img      string  `json:"img"`
-		Position string  `json:"position"`
-		Text     string  `json:"text"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
+type captionParams struct {
+	FontSize  fontSize                `json:"fontsize" desc:"Font size in pixels, or \"auto\" (the default) to fit the text"`
+	Img       string                  `json:"img" required:"true" desc:"Image URL"`
+	Position  string                  `json:"position" desc:"Where a bar or modern caption goes, top (the default) or bottom"`
+	Style     string                  `json:"style" desc:"Caption style: bar (the default), modern, demotivational or subtitle"`
+	Subtitle  string                  `json:"subtitle" desc:"Smaller line under the title of a demotivational poster"`
+	Text      string                  `json:"text" required:"true" desc:"Caption text"`
+	TextStyle textlayout.StyleOptions `json:"textStyle" desc:"Overrides of the text style: fill, stroke, shadow and background colors, strokeWidth, shadowOffset and backgroundPadding"`
+}
 
-	if requestBody.Position != "top" && requestBody.Position != "bottom" {
-		http.Error(w, "Invalid position, must be 'top' or 'bottom'", http.StatusBadRequest)
-		return
+func (p *captionParams) caption() fun.Caption {
+	return fun.Caption{
+		Style:     p.Style,
+		Text:      p.Text,
+		Subtitle:  p.Subtitle,
+		Position:  p.Position,
+		FontSize:  float64(p.FontSize),
+		TextStyle: p.TextStyle,
 	}
+}
 
-	if requestBody.FontSize <= 0 {
-		http.Error(w, "Font size must be a positive number", http.StatusBadRequest)
-		return
-	}
-	if requestBody.Img == "" || requestBody.Text == "" {
-		http.Error(w, "Image URL and text cannot be empty", http.StatusBadRequest)
-		return
-	}
+type captionGenerator struct{}
 
-	img, err := fun.MakeCaptionImage(requestBody.Img, requestBody.FontSize, requestBody.Text, requestBody.Position)
+func (captionGenerator) Description() string {
+	return "A caption around or over an image: a white bar, a modern caption, a demotivational poster or subtitles"
+}
 
-	if err != nil {
-		http.Error(w, "Failed to generate caption image: "+err.Error(), http.StatusInternalServerError)
-		return
+func (captionGenerator) Validate(p *captionParams) error {
+	if p.Position != "" && p.Position != "top" && p.Position != "bottom" {
+		return errors.New("Invalid position, must be 'top' or 'bottom'")
 	}
-
-	w.Header().Set("Content-Type", "image/png")
-	if err := png.Encode(w, img); err != nil {
-		http.Error(w, "Failed to encode image: "+err.Error(), http.StatusInternalServerError)
-		return
+	if styles := fun.CaptionStyles(); p.Style != "" && !slices.Contains(styles, p.Style) {
+		return fmt.Errorf("Invalid style, must be one of %s", strings.Join(styles, ", "))
+	}
+	if p.FontSize < 0 {
+		return errors.New("Font size must be a positive number or \"auto\"")
 	}
+	if p.Img == "" || p.Text == "" {
+		return errors.New("Image URL and text cannot be empty")
+	}
+	_, err := p.caption().ResolveStyle()
+	return err
+}
+
+func (captionGenerator) Render(ctx context.Context, p *captionParams) (image.Image, error) {
+	return fun.MakeCaptionImage(ctx, p.Img, p.caption())
 }
@@ -0,0 +1,46 @@
+package fun
+
+import (
+	"context"
+	"errors"
+	"image"
+	"strconv"
+
+	"jasper/generators/skullboard"
+)
+
+const maxConversationMessages = 25
+
+type conversationParams struct {
+	Messages []messageRequest `json:"messages" required:"true" desc:"Messages in order, each taking the skullboard parameters"`
+	themeRequest
+}
+
+type conversationGenerator struct{}
+
+func (conversationGenerator) Description() string {
+	return "A Discord conversation of up to 25 messages, grouped like in the client"
+}
+
+func (conversationGenerator) Validate(p *conversationParams) error {
+	if len(p.Messages) == 0 {
+		return errors.New("At least one message is required")
+	}
+	if len(p.Messages) > maxConversationMessages {
+		return errors.New("At most " + strconv.Itoa(maxConversationMessages) + " messages are allowed")
+	}
+	_, err := p.resolve()
+	return err
+}
+
+func (conversationGenerator) Render(ctx context.Context, p *conversationParams) (image.Image, error) {
+	theme, err := p.resolve()
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]skullboard.MessageData, len(p.Messages))
+	for i, msg := range p.Messages {
+		messages[i] = msg.messageData()
+	}
+	return skullboard.GenerateConversation(ctx, messages, theme)
+}
@@ -0,0 +1,45 @@
+package fun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+
+	"jasper/generators/effects"
+)
+
+type effectsParams struct {
+	Img        string            `json:"img" required:"true" desc:"Image URL"`
+	Operations []json.RawMessage `json:"operations" required:"true" desc:"Effects to apply in order, each an object with its name in op and its parameters, e.g. {\"op\": \"blur\", \"radius\": 4}"`
+
+	// ops is Operations as parsed by Validate.
+	ops []effects.Operation
+}
+
+type effectsGenerator struct{}
+
+func (effectsGenerator) Description() string {
+	return "Image effects applied in order: " + strings.Join(effects.Names(), ", ")
+}
+
+func (effectsGenerator) Validate(p *effectsParams) error {
+	if p.Img == "" {
+		return errors.New("Image URL cannot be empty")
+	}
+	if len(p.Operations) == 0 || len(p.Operations) > effects.MaxOperations {
+		return fmt.Errorf("Operations must have between 1 and %d entries", effects.MaxOperations)
+	}
+	ops, err := effects.Parse(p.Operations)
+	if err != nil {
+		return fmt.Errorf("Invalid %w", err)
+	}
+	p.ops = ops
+	return nil
+}
+
+func (effectsGenerator) Render(ctx context.Context, p *effectsParams) (image.Image, error) {
+	return effects.GenImage(ctx, p.Img, p.ops)
+}
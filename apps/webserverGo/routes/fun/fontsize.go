@@ -0,0 +1,29 @@
+package fun
+
+import (
+	"encoding/json"
+	"errors"
+
+	"jasper/textlayout"
+)
+
+// fontSize is a font size in pixels, or the string "auto" to fit the text to
+// the space it has. Leaving it out is the same as "auto".
+type fontSize float64
+
+func (f *fontSize) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		if s != "auto" {
+			return errors.New(`font size must be a number or "auto"`)
+		}
+		*f = textlayout.AutoFontSize
+		return nil
+	}
+	var n float64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*f = fontSize(n)
+	return nil
+}
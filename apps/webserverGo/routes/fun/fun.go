@@ -0,0 +1,73 @@
+package fun
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"jasper/generators"
+	"jasper/utils"
+)
+
+// Generators holds every generator served under /fun/{name}. Adding an image
+// effect only takes registering its generator here.
+var Generators = newRegistry()
+
+func newRegistry() *generators.Registry {
+	r := generators.NewRegistry()
+	generators.Register(r, "caption", captionGenerator{})
+	generators.Register(r, "conversation", conversationGenerator{})
+	generators.Register(r, "effects", effectsGenerator{})
+	generators.Register(r, "frame", frameGenerator{})
+	generators.Register(r, "jail", jailGenerator{})
+	generators.Register(r, "meme", memeGenerator{})
+	generators.Register(r, "skullboard", skullboardGenerator{})
+	generators.Register(r, "speechbubble", bubbleGenerator{})
+	generators.Register(r, "triggered", triggeredGenerator{})
+	generators.Register(r, "wanted", wantedGenerator{})
+	return r
+}
+
+// IndexHandler lists the generators with their parameters.
+func IndexHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"generators": Generators.Index()})
+}
+
+// GenerateHandler renders the generator named in the path from the JSON body.
+func GenerateHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if !Generators.Has(name) {
+		http.Error(w, "Unknown generator "+name, http.StatusNotFound)
+		return
+	}
+
+	img, err := Generators.Render(r.Context(), name, r.Body)
+	if err != nil {
+		var invalid *generators.InvalidParamsError
+		if errors.As(err, &invalid) {
+			http.Error(w, invalid.Error(), http.StatusBadRequest)
+			return
+		}
+		renderFailed(w, r, "Failed to generate "+name+" image", err)
+		slog.Error("Failed to generate image", "generator", name, "error", err)
+		return
+	}
+
+	if anim, ok := img.(*generators.GIF); ok {
+		w.Header().Set("Content-Type", "image/gif")
+		if err := utils.EncodeGIF(r.Context(), w, anim.Frames, anim.Delay); err != nil {
+			renderFailed(w, r, "Failed to encode image", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	if err := utils.EncodePNG(r.Context(), w, img); err != nil {
+		renderFailed(w, r, "Failed to encode image", err)
+		return
+	}
+}
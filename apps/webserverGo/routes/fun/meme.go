@@ -1,44 +1,70 @@
 package fun
 
 import (
+	"context"
 	"encoding/json"
-	"image/png"
+	"errors"
+	"fmt"
+	"image"
 	"net/http"
 
 	"jasper/generators/meme"
+	"jasper/textlayout"
 )
 
-func MemeHandler(w http.ResponseWriter, r *http.Request) {
-	var requestBody struct {
-		BottomText string  `json:"bottomtext"`
-		FontSize   float64 `json:"fontsize"`
-		Img        string  `json:"img"`
-		TopText    string  `json:"toptext"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
+type memeParams struct {
+	BottomText string                  `json:"bottomtext" desc:"Text along the bottom edge"`
+	FontSize   fontSize                `json:"fontsize" desc:"Font size for a 500px wide image, scaled with the image width, or \"auto\" (the default) to fit the text"`
+	Img        string                  `json:"img" desc:"Image URL; required without template"`
+	TopText    string                  `json:"toptext" desc:"Text along the top edge"`
+	Template   string                  `json:"template" desc:"Template ID from /fun/meme/templates, used instead of img"`
+	Texts      []string                `json:"texts" desc:"Texts for the boxes of the template, in order"`
+	TextStyle  textlayout.StyleOptions `json:"textStyle" desc:"Overrides of the text style: fill, stroke, shadow and background colors, strokeWidth, shadowOffset and backgroundPadding"`
+}
 
-	if requestBody.FontSize <= 0 {
-		http.Error(w, "Font size must be a positive number", http.StatusBadRequest)
-		return
-	}
-	if requestBody.Img == "" || (requestBody.TopText == "" && requestBody.BottomText == "") {
-		http.Error(w, "Image URL and text cannot be empty", http.StatusBadRequest)
-		return
-	}
+type memeGenerator struct{}
+
+func (memeGenerator) Description() string {
+	return "Impact top and bottom text over an image, or texts in the boxes of a meme template"
+}
 
-	img, err := meme.GenImage(requestBody.Img, requestBody.FontSize, requestBody.TopText, requestBody.BottomText)
+func (memeGenerator) Validate(p *memeParams) error {
+	if p.Template != "" {
+		t, ok := meme.TemplateByID(p.Template)
+		if !ok {
+			return fmt.Errorf("Unknown template %q", p.Template)
+		}
+		if p.Img != "" {
+			return errors.New("Use either img or template, not both")
+		}
+		if len(p.Texts) == 0 || len(p.Texts) > len(t.Boxes) {
+			return fmt.Errorf("Template %s takes 1 to %d texts", t.ID, len(t.Boxes))
+		}
+	} else {
+		if p.FontSize < 0 {
+			return errors.New("Font size must be a positive number or \"auto\"")
+		}
+		if p.Img == "" || (p.TopText == "" && p.BottomText == "") {
+			return errors.New("Image URL and text cannot be empty")
+		}
+	}
+	_, err := textlayout.Impact.With(p.TextStyle)
+	return err
+}
 
+func (memeGenerator) Render(ctx context.Context, p *memeParams) (image.Image, error) {
+	if p.Template != "" {
+		return meme.GenTemplate(ctx, p.Template, p.Texts, p.TextStyle)
+	}
+	style, err := textlayout.Impact.With(p.TextStyle)
 	if err != nil {
-		http.Error(w, "Failed to generate meme image: "+err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
+	return meme.GenImage(ctx, p.Img, float64(p.FontSize), p.TopText, p.BottomText, style)
+}
 
-	w.Header().Set("Content-Type", "image/png")
-	if err := png.Encode(w, img); err != nil {
-		http.Error(w, "Failed to encode image: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
+// MemeTemplatesHandler lists the meme templates with their text boxes.
+func MemeTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"templates": meme.Templates()})
 }
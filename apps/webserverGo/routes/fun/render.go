@@ -0,0 +1,22 @@
+package fun
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// renderFailed replies to a failed render or encode. A render that ran out of
+// time gets 504 Gateway Timeout, and nothing is written to a client that has
+// already gone away.
+func renderFailed(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, msg+": render timed out", http.StatusGatewayTimeout)
+	case errors.Is(err, context.Canceled):
+		slog.Info("Client went away before the render finished", "path", r.URL.Path)
+	default:
+		http.Error(w, msg+": "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -1,62 +1,102 @@
 package fun
 
 import (
-	"encoding/json"
-	"image/png"
-	"log/slog"
-	"net/http"
+	"context"
+	"image"
+	"time"
 
 	"jasper/generators/skullboard"
 )
 
-func SkullboardHandler(w http.ResponseWriter, r *http.Request) {
-	var requestBody struct {
-		Attachments        []string `json:"attachments"`
-		Avatar             string   `json:"avatar"`
-		Content            string   `json:"content"`
-		RoleIcon           string   `json:"roleIcon"`
-		Timestamp          string   `json:"timestamp"`
-        Mentions           []string `json:"mentions"`
-		Username           string   `json:"username"`
-		UsernameColor      string   `json:"usernameColor"`
-		ReplyAvatar        string   `json:"replyAvatar"`
-		ReplyContent       string   `json:"replyContent"`
-		ReplyUsername      string   `json:"replyUsername"`
-		ReplyUsernameColor string   `json:"replyUsernameColor"`
-	}
+// messageRequest is a Discord message as sent to the skullboard and
+// conversation endpoints.
+type messageRequest struct {
+	ID                  string                  `json:"id" desc:"Message ID, referenced by replyTo in conversations"`
+	AuthorID            string                  `json:"authorId" desc:"Author ID, used to group messages in conversations"`
+	CreatedAt           time.Time               `json:"createdAt" desc:"RFC 3339 time the message was sent"`
+	ReplyTo             string                  `json:"replyTo" desc:"ID of an earlier message in the conversation this message replies to"`
+	Attachments         []skullboard.Attachment `json:"attachments" desc:"Discord attachment objects or image URLs"`
+	Embeds              []skullboard.Embed      `json:"embeds" desc:"Discord embed objects"`
+	Stickers            []skullboard.Sticker    `json:"stickers" desc:"Discord sticker objects"`
+	Avatar              string                  `json:"avatar" desc:"Avatar URL of the author"`
+	Content             string                  `json:"content" desc:"Message content as Discord markdown"`
+	RoleIcon            string                  `json:"roleIcon" desc:"Role icon URL shown after the username"`
+	Timestamp           string                  `json:"timestamp" desc:"Timestamp text shown after the username"`
+	Mentions            []skullboard.Mention    `json:"mentions" desc:"Names of the users, roles and channels mentioned in content"`
+	Username            string                  `json:"username" desc:"Display name of the author"`
+	UsernameColor       string                  `json:"usernameColor" desc:"Role color of the username as #rrggbb"`
+	ReplyAvatar         string                  `json:"replyAvatar" desc:"Avatar URL of the replied-to author"`
+	ReplyContent        string                  `json:"replyContent" desc:"Content of the replied-to message"`
+	ReplyUsername       string                  `json:"replyUsername" desc:"Display name of the replied-to author"`
+	ReplyUsernameColor  string                  `json:"replyUsernameColor" desc:"Role color of the replied-to username as #rrggbb"`
+	ReplyHasAttachments bool                    `json:"replyHasAttachments" desc:"Whether the replied-to message has attachments"`
+	ReplyDeleted        bool                    `json:"replyDeleted" desc:"Whether the replied-to message was deleted"`
+}
+
+// themeRequest selects a built-in theme and optionally overrides its colors.
+type themeRequest struct {
+	Theme   string              `json:"theme" desc:"Built-in theme: dark, light or amoled"`
+	Palette *skullboard.Palette `json:"palette" desc:"Color overrides for the theme"`
+}
 
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		slog.Error("Failed to decode request body", "error", err)
-		return
+func (t themeRequest) resolve() (skullboard.Theme, error) {
+	theme, err := skullboard.ThemeByName(t.Theme)
+	if err != nil || t.Palette == nil {
+		return theme, err
 	}
+	return theme.WithPalette(*t.Palette)
+}
 
-	img, err := skullboard.GenerateDiscordMessage(skullboard.MessageData{
-		ReplyAvatar:        requestBody.ReplyAvatar,
-		ReplyUsernameColor: requestBody.ReplyUsernameColor,
-		ReplyUsername:      requestBody.ReplyUsername,
-		ReplyContent:       requestBody.ReplyContent,
+func (m messageRequest) messageData() skullboard.MessageData {
+	return skullboard.MessageData{
+		ID:        m.ID,
+		AuthorID:  m.AuthorID,
+		CreatedAt: m.CreatedAt,
+		ReplyTo:   m.ReplyTo,
 
-		Avatar:        requestBody.Avatar,
-		UsernameColor: requestBody.UsernameColor,
-		Username:      requestBody.Username,
-		RoleIconURL:   requestBody.RoleIcon,
-		Timestamp:     requestBody.Timestamp,
-		Content:       requestBody.Content,
-        Mentions:      requestBody.Mentions,
+		ReplyAvatar:         m.ReplyAvatar,
+		ReplyUsernameColor:  m.ReplyUsernameColor,
+		ReplyUsername:       m.ReplyUsername,
+		ReplyContent:        m.ReplyContent,
+		ReplyHasAttachments: m.ReplyHasAttachments,
+		ReplyDeleted:        m.ReplyDeleted,
 
-		Attachments: requestBody.Attachments,
-	})
+		Avatar:        m.Avatar,
+		UsernameColor: m.UsernameColor,
+		Username:      m.Username,
+		RoleIconURL:   m.RoleIcon,
+		Timestamp:     m.Timestamp,
+		Content:       m.Content,
+		Mentions:      m.Mentions,
 
-	if err != nil {
-		http.Error(w, "Failed to generate image: "+err.Error(), http.StatusInternalServerError)
-		slog.Error("Failed to generate skullboard image", "error", err)
-		return
+		Attachments: m.Attachments,
+		Embeds:      m.Embeds,
+		Stickers:    m.Stickers,
 	}
-	w.Header().Set("Content-Type", "image/png")
+}
 
-	if err := png.Encode(w, img); err != nil {
-		http.Error(w, "Failed to encode image: "+err.Error(), http.StatusInternalServerError)
-		return
+type skullboardParams struct {
+	messageRequest
+	themeRequest
+}
+
+type skullboardGenerator struct{}
+
+func (skullboardGenerator) Description() string {
+	return "A Discord message as it looks in the client"
+}
+
+func (skullboardGenerator) Validate(p *skullboardParams) error {
+	_, err := p.resolve()
+	return err
+}
+
+func (skullboardGenerator) Render(ctx context.Context, p *skullboardParams) (image.Image, error) {
+	theme, err := p.resolve()
+	if err != nil {
+		return nil, err
 	}
+	data := p.messageData()
+	data.Theme = theme
+	return skullboard.GenerateDiscordMessage(ctx, data)
 }
@@ -1,37 +1,79 @@
 package fun
 
 import (
-	"encoding/json"
-	"image/png"
+	"context"
+	"errors"
+	"image"
+
+	"jasper/generators"
 	"jasper/generators/speechbubble"
-	"net/http"
+	"jasper/utils"
 )
 
-func BubbleHandler(w http.ResponseWriter, r *http.Request) {
-	var requestBody struct {
-		Img      string `json:"img"`
-		Position string `json:"position"`
+type bubbleParams struct {
+	Color    string   `json:"color" desc:"Bubble color as #rrggbb or #rrggbbaa, white by default"`
+	Cutout   bool     `json:"cutout" desc:"Erase the bubble from the image, leaving it transparent"`
+	Format   string   `json:"format" desc:"Output format, png (the default) or gif"`
+	Height   float64  `json:"height" desc:"Bubble height as a share of the image height, 0.1 by default"`
+	Img      string   `json:"img" required:"true" desc:"Image URL"`
+	Position string   `json:"position" required:"true" desc:"Where the bubble goes, top or bottom"`
+	Tail     string   `json:"tail" desc:"Side the tail hangs from: left (the default), right or center"`
+	TailX    *float64 `json:"tailX" desc:"Where the tip of the tail points, as a share of the image width from the left"`
+}
+
+type bubbleGenerator struct{}
+
+func (bubbleGenerator) Description() string {
+	return "A speech bubble over the top or bottom of an image, or cut out of it"
+}
+
+func (bubbleGenerator) Validate(p *bubbleParams) error {
+	if p.Position != "top" && p.Position != "bottom" {
+		return errors.New("Invalid position, must be 'top' or 'bottom'")
 	}
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+	switch p.Tail {
+	case "", speechbubble.TailLeft, speechbubble.TailRight, speechbubble.TailCenter:
+	default:
+		return errors.New("Invalid tail, must be 'left', 'right' or 'center'")
 	}
-
-	if requestBody.Position != "top" && requestBody.Position != "bottom" {
-		http.Error(w, "Invalid position, must be 'top' or 'bottom'", http.StatusBadRequest)
-		return
+	if p.TailX != nil && (*p.TailX < 0 || *p.TailX > 1) {
+		return errors.New("Tail position must be between 0 and 1")
 	}
+	if p.Height < 0 || p.Height > 0.5 {
+		return errors.New("Height must be between 0 and 0.5")
+	}
+	if p.Format != "" && p.Format != "png" && p.Format != "gif" {
+		return errors.New("Invalid format, must be 'png' or 'gif'")
+	}
+	if p.Color != "" {
+		if _, err := utils.ParseHexColor(p.Color); err != nil {
+			return errors.New("Invalid color, must be #rrggbb or #rrggbbaa")
+		}
+	}
+	return nil
+}
 
-	img, err := speechbubble.GenImage(requestBody.Img, requestBody.Position)
-
+func (bubbleGenerator) Render(ctx context.Context, p *bubbleParams) (image.Image, error) {
+	bubble := speechbubble.Bubble{
+		Position: p.Position,
+		Tail:     p.Tail,
+		TailX:    p.TailX,
+		Height:   p.Height,
+		Cutout:   p.Cutout,
+	}
+	if p.Color != "" {
+		c, err := utils.ParseHexColor(p.Color)
+		if err != nil {
+			return nil, err
+		}
+		bubble.Color = c
+	}
+	img, err := speechbubble.GenImage(ctx, p.Img, bubble)
 	if err != nil {
-		http.Error(w, "Failed to generate speechbubble image: "+err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
-
-	w.Header().Set("Content-Type", "image/png")
-	if err := png.Encode(w, img); err != nil {
-		http.Error(w, "Failed to encode image: "+err.Error(), http.StatusInternalServerError)
-		return
+	if p.Format == "gif" {
+		return &generators.GIF{Frames: []image.Image{img}}, nil
 	}
+	return img, nil
 }
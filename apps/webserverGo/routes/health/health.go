@@ -0,0 +1,72 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"jasper/assets"
+	"jasper/buildinfo"
+	"jasper/utils"
+)
+
+type check struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func newCheck(name string, err error) check {
+	c := check{Name: name, OK: err == nil}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	return c
+}
+
+// LivenessHandler only reports that the process is serving requests.
+func LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// ReadinessHandler reports whether the server can actually render images and
+// talk to YouTube: every font and overlay asset must load and at least one
+// YouTube API key has to be configured.
+func ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	var checks []check
+	ready := true
+
+	for _, c := range assets.Verify() {
+		checks = append(checks, newCheck(c.Name, c.Err))
+	}
+
+	youtube := check{Name: "youtube:apiKey", OK: utils.HasYoutubeApiKey()}
+	if !youtube.OK {
+		youtube.Error = "no YOUTUBE_API_KEY_* variable is set"
+	}
+	checks = append(checks, youtube)
+
+	for _, c := range checks {
+		ready = ready && c.OK
+	}
+
+	status := http.StatusOK
+	body := map[string]any{"status": "ready", "checks": checks}
+	if !ready {
+		status = http.StatusServiceUnavailable
+		body["status"] = "not ready"
+	}
+	writeJSON(w, status, body)
+}
+
+// VersionHandler reports the build the server is running: the git commit and
+// build time it was stamped with and the Go version it was built with.
+func VersionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, buildinfo.Get())
+}
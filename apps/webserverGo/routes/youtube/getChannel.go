@@ -13,7 +13,7 @@ func ChannelInfoHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	channelID := vars["id"]
 
-	data, err := utils.FetchChannelData(channelID)
+	data, err := utils.FetchChannelData(r.Context(), channelID)
 	if err != nil {
 		http.Error(w, "Error fetching data", http.StatusInternalServerError)
 		return
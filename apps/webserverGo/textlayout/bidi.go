@@ -0,0 +1,211 @@
+package textlayout
+
+import (
+	"log/slog"
+	"slices"
+	"unicode"
+
+	"github.com/go-text/typesetting/bidi"
+
+	"jasper/fonts"
+)
+
+var rtlScripts = []*unicode.RangeTable{
+	unicode.Arabic,
+	unicode.Hebrew,
+	unicode.Syriac,
+	unicode.Thaana,
+	unicode.Nko,
+	unicode.Samaritan,
+	unicode.Mandaic,
+	unicode.Adlam,
+}
+
+// hasRTL reports whether s has any right-to-left characters, and so needs
+// the bidirectional algorithm and shaping to be drawn.
+func hasRTL(s string) bool {
+	for _, r := range s {
+		if r >= 0x590 && unicode.In(r, rtlScripts...) {
+			return true
+		}
+	}
+	return false
+}
+
+// RTL reports whether text is a right-to-left paragraph, which is decided by
+// its first letter like the Unicode bidirectional algorithm does.
+func RTL(text string) bool {
+	return ClassOf(text) == RightToLeft
+}
+
+type directionalRun struct {
+	text string
+	rtl  bool
+}
+
+// visualRuns splits a line into runs of a single direction with the Unicode
+// bidirectional algorithm (UAX #9) and puts them in display order.
+func visualRuns(line string) []directionalRun {
+	direction := bidi.LeftToRight
+	if RTL(line) {
+		direction = bidi.RightToLeft
+	}
+	text := []rune(line)
+	var p bidi.Paragraph
+	segmented := p.Segment(text, direction)
+
+	runs := make([]directionalRun, segmented.NumRuns())
+	levels := make([]bidi.Level, len(runs))
+	for i := range runs {
+		run := segmented.Run(i)
+		runs[i] = directionalRun{text: string(text[run.Start:run.End]), rtl: !run.IsLeftToRight()}
+		levels[i] = run.Level
+	}
+	order := reorder(levels)
+	visual := make([]directionalRun, len(runs))
+	for i, j := range order {
+		visual[i] = runs[j]
+	}
+	return visual
+}
+
+// reorder returns the display order of pieces of a line at the given
+// embedding levels: from the highest level down to the lowest odd one, every
+// sequence of pieces at that level or higher is reversed (rule L2).
+func reorder(levels []bidi.Level) []int {
+	order := make([]int, len(levels))
+	for i := range order {
+		order[i] = i
+	}
+	if len(levels) == 0 {
+		return order
+	}
+	levels = slices.Clone(levels)
+
+	highest, lowestOdd := slices.Max(levels), slices.Max(levels)+1
+	for _, level := range levels {
+		if level%2 == 1 {
+			lowestOdd = min(lowestOdd, level)
+		}
+	}
+	for level := highest; level >= lowestOdd; level-- {
+		for i := 0; i < len(levels); {
+			if levels[i] < level {
+				i++
+				continue
+			}
+			j := i
+			for j < len(levels) && levels[j] >= level {
+				j++
+			}
+			slices.Reverse(order[i:j])
+			slices.Reverse(levels[i:j])
+			i = j
+		}
+	}
+	return order
+}
+
+// Class is the direction of a piece of text.
+type Class int
+
+const (
+	Neutral Class = iota
+	LeftToRight
+	RightToLeft
+)
+
+// ClassOf returns the direction of the first letter of s, or Neutral for text
+// without letters, like spaces, digits and punctuation.
+func ClassOf(s string) Class {
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			if unicode.In(r, rtlScripts...) {
+				return RightToLeft
+			}
+			return LeftToRight
+		}
+	}
+	return Neutral
+}
+
+// VisualOrder returns the display order of the pieces of a line, like words
+// in different styles, from their classes. A neutral piece between two of the
+// same direction takes it and any other takes the paragraph's (rules N1 and
+// N2). Right-to-left runs are then reversed as in the bidirectional algorithm.
+func VisualOrder(classes []Class, rtl bool) []int {
+	paragraph := LeftToRight
+	if rtl {
+		paragraph = RightToLeft
+	}
+	levels := make([]bidi.Level, len(classes))
+	for i := 0; i < len(classes); {
+		class := classes[i]
+		j := i + 1
+		if class == Neutral {
+			for j < len(classes) && classes[j] == Neutral {
+				j++
+			}
+			before, after := paragraph, paragraph
+			if i > 0 {
+				before = classes[i-1]
+			}
+			if j < len(classes) {
+				after = classes[j]
+			}
+			class = paragraph
+			if before == after {
+				class = before
+			}
+		}
+		level := bidi.Level(0)
+		switch {
+		case class == RightToLeft:
+			level = 1
+		case rtl:
+			level = 2
+		}
+		for k := i; k < j; k++ {
+			levels[k] = level
+		}
+		i = j
+	}
+	return reorder(levels)
+}
+
+// lineGlyphs lays out a line for drawing. Lines with right-to-left text are
+// reordered and shaped, so Arabic letters join.
+func lineGlyphs(face *fonts.MultiFace, line string) []fonts.Glyph {
+	if !hasRTL(line) {
+		return face.Glyphs(line)
+	}
+	var all []fonts.Glyph
+	x := 0.0
+	for _, run := range visualRuns(line) {
+		shaped, width, err := face.Shape(run.text, run.rtl)
+		if err != nil {
+			slog.Error("Failed to shape text", "error", err)
+			return face.Glyphs(line)
+		}
+		for _, g := range shaped {
+			g.X += x
+			all = append(all, g)
+		}
+		x += width
+	}
+	return all
+}
+
+// shapedWidth is the width of a line with right-to-left text as laid out by
+// lineGlyphs.
+func shapedWidth(face *fonts.MultiFace, line string) (float64, bool) {
+	total := 0.0
+	for _, run := range visualRuns(line) {
+		_, width, err := face.Shape(run.text, run.rtl)
+		if err != nil {
+			return 0, false
+		}
+		total += width
+	}
+	return total, true
+}
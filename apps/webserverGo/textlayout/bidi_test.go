@@ -0,0 +1,136 @@
+package textlayout
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/go-text/typesetting/bidi"
+
+	"jasper/fonts"
+)
+
+func TestRTL(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"hello", false},
+		{"שלום", true},
+		{"مرحبا", true},
+		{"hello שלום", false},
+		{"שלום hello", true},
+		{"123 שלום", true},
+		{"!? 42", false},
+	}
+	for _, tt := range tests {
+		if got := RTL(tt.text); got != tt.want {
+			t.Errorf("RTL(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestVisualRuns(t *testing.T) {
+	type run struct {
+		text string
+		rtl  bool
+	}
+	tests := []struct {
+		name string
+		line string
+		want []run
+	}{
+		{"left to right", "hello world", []run{{"hello world", false}}},
+		{"rtl word in ltr line", "hello שלום world", []run{{"hello ", false}, {"שלום", true}, {" world", false}}},
+		{"ltr word in rtl line", "שלום hello עולם", []run{{" עולם", true}, {"hello", false}, {"שלום ", true}}},
+		{"number in rtl line", "מחיר 100 שקל", []run{{" שקל", true}, {"100", false}, {"מחיר ", true}}},
+		{"version in rtl line", "גרסה 1.2.3 חדשה", []run{{" חדשה", true}, {"1.2.3", false}, {"גרסה ", true}}},
+		{"arabic with digits", "العدد 42", []run{{"42", false}, {"العدد ", true}}},
+		{"brackets in rtl line", "שלום (hello) עולם", []run{{") עולם", true}, {"hello", false}, {"שלום (", true}}},
+		{"bracketed rtl word", "(שלום)", []run{{"(שלום)", true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []run
+			for _, r := range visualRuns(tt.line) {
+				got = append(got, run{r.text, r.rtl})
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("visualRuns(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReorder(t *testing.T) {
+	tests := []struct {
+		levels []bidi.Level
+		want   []int
+	}{
+		{nil, []int{}},
+		{[]bidi.Level{0, 0, 0}, []int{0, 1, 2}},
+		{[]bidi.Level{1, 1, 1}, []int{2, 1, 0}},
+		{[]bidi.Level{0, 1, 1, 0}, []int{0, 2, 1, 3}},
+		// An LTR number in RTL text stays in reading order.
+		{[]bidi.Level{1, 2, 1}, []int{2, 1, 0}},
+		{[]bidi.Level{1, 2, 2, 1}, []int{3, 1, 2, 0}},
+	}
+	for _, tt := range tests {
+		if got := reorder(tt.levels); !slices.Equal(got, tt.want) {
+			t.Errorf("reorder(%v) = %v, want %v", tt.levels, got, tt.want)
+		}
+	}
+}
+
+func TestVisualOrder(t *testing.T) {
+	const (
+		N = Neutral
+		L = LeftToRight
+		R = RightToLeft
+	)
+	tests := []struct {
+		classes []Class
+		rtl     bool
+		want    []int
+	}{
+		{[]Class{L, N, L}, false, []int{0, 1, 2}},
+		{[]Class{L, N, R, N, R}, false, []int{0, 1, 4, 3, 2}},
+		{[]Class{R, N, R}, true, []int{2, 1, 0}},
+		{[]Class{R, N, L, N, R}, true, []int{4, 3, 2, 1, 0}},
+		{[]Class{R, N, L, N, L, N, R}, true, []int{6, 5, 2, 3, 4, 1, 0}},
+		// A neutral between opposite directions takes the paragraph's.
+		{[]Class{L, N, R}, false, []int{0, 1, 2}},
+		{[]Class{L, N, R}, true, []int{2, 1, 0}},
+	}
+	for _, tt := range tests {
+		if got := VisualOrder(tt.classes, tt.rtl); !slices.Equal(got, tt.want) {
+			t.Errorf("VisualOrder(%v, %v) = %v, want %v", tt.classes, tt.rtl, got, tt.want)
+		}
+	}
+}
+
+// Brackets in right-to-left runs are drawn mirrored, so they still open
+// toward the text they enclose.
+func TestMirroredBrackets(t *testing.T) {
+	face, err := fonts.Face(fonts.Sans, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open, close := face.Glyphs("(")[0], face.Glyphs(")")[0]
+
+	glyphs := lineGlyphs(face, "(שלום)")
+	first, last := glyphs[0], glyphs[len(glyphs)-1]
+	// Visually the line starts with the logical closing bracket, drawn as an
+	// opening one.
+	if first.Rune != ')' || fmt.Sprint(first.Segments) != fmt.Sprint(open.Segments) {
+		t.Errorf("leftmost glyph is %q, want ')' drawn as '('", first.Rune)
+	}
+	if last.Rune != '(' || fmt.Sprint(last.Segments) != fmt.Sprint(close.Segments) {
+		t.Errorf("rightmost glyph is %q, want '(' drawn as ')'", last.Rune)
+	}
+	for i := 1; i < len(glyphs); i++ {
+		if glyphs[i].X < glyphs[i-1].X {
+			t.Errorf("glyph %d at %v is left of glyph %d at %v", i, glyphs[i].X, i-1, glyphs[i-1].X)
+		}
+	}
+}
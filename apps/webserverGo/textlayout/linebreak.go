@@ -0,0 +1,133 @@
+package textlayout
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/image/font"
+)
+
+// Segment is a piece of text that a line may break after, as found by the
+// Unicode line breaking algorithm (UAX #14). Spaces after a word belong to
+// its segment.
+type Segment struct {
+	Text string
+	// Mandatory segments must end their line, like those ending in a newline.
+	Mandatory bool
+}
+
+// Word returns the segment without its trailing whitespace, which hangs past
+// the end of a line rather than counting toward its width.
+func (s Segment) Word() string {
+	return strings.TrimRightFunc(s.Text, unicode.IsSpace)
+}
+
+// Segments splits text at its line break opportunities. Text without spaces,
+// like Chinese or Japanese, can break between most characters.
+func Segments(text string) []Segment {
+	var segments []Segment
+	state := -1
+	for text != "" {
+		var segment string
+		var mustBreak bool
+		segment, text, mustBreak, state = uniseg.FirstLineSegmentInString(text, state)
+		// The end of the text is a mandatory break too, but not one that
+		// starts a new line.
+		segments = append(segments, Segment{Text: segment, Mandatory: mustBreak && text != ""})
+	}
+	return segments
+}
+
+// Break splits a word that is too wide for a line between its grapheme
+// clusters, so accents and emoji sequences stay whole. The first piece fits
+// in firstWidth, which may be less than maxWidth to finish a line that has
+// text on it already, and is empty if not even one cluster fits there. The
+// other pieces fit in maxWidth or are a single cluster. With hyphen set, a
+// piece that ends between two letters ends with a hyphen.
+func Break(face font.Face, word string, firstWidth, maxWidth float64, hyphen bool) []string {
+	var pieces []string
+	var piece string
+	limit := firstWidth
+	state := -1
+	for word != "" {
+		var cluster string
+		cluster, word, _, state = uniseg.FirstGraphemeClusterInString(word, state)
+
+		candidate := piece + cluster
+		width := Measure(face, candidate)
+		if hyphen && joinsLetters(candidate, word) {
+			// Leave room for the hyphen in case the word breaks after this.
+			width = Measure(face, candidate+"-")
+		}
+		emptyFirst := len(pieces) == 0 && limit < maxWidth
+		if width > limit && (piece != "" || emptyFirst) {
+			if hyphen && joinsLetters(piece, cluster) {
+				piece += "-"
+			}
+			pieces = append(pieces, piece)
+			piece, limit = cluster, maxWidth
+			continue
+		}
+		piece = candidate
+	}
+	return append(pieces, piece)
+}
+
+// joinsLetters reports whether before ends and after starts with a letter or
+// digit, so a break between them takes a hyphen. Marks belong to the letter
+// they follow.
+func joinsLetters(before, after string) bool {
+	before = strings.TrimRightFunc(before, unicode.IsMark)
+	last, _ := utf8.DecodeLastRuneInString(before)
+	first, _ := utf8.DecodeRuneInString(after)
+	isLetter := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+	return before != "" && isLetter(last) && isLetter(first)
+}
+
+// Wrap breaks text into lines no wider than maxWidth at its line break
+// opportunities and newlines. Words wider than a line are broken between
+// characters with a hyphen.
+func Wrap(face font.Face, text string, maxWidth float64) []string {
+	lines, _ := wrap(face, text, maxWidth)
+	return lines
+}
+
+// wrap is Wrap, also reporting whether a word had to be broken.
+func wrap(face font.Face, text string, maxWidth float64) ([]string, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, false
+	}
+
+	var lines []string
+	var line string
+	broken := false
+	flush := func() {
+		lines = append(lines, strings.TrimRightFunc(line, unicode.IsSpace))
+		line = ""
+	}
+
+	for _, segment := range Segments(text) {
+		word := segment.Word()
+		if line != "" && Measure(face, line+word) > maxWidth {
+			flush()
+		}
+		if line == "" && Measure(face, word) > maxWidth {
+			pieces := Break(face, word, maxWidth, maxWidth, true)
+			lines = append(lines, pieces[:len(pieces)-1]...)
+			line = pieces[len(pieces)-1] + segment.Text[len(word):]
+			broken = true
+		} else {
+			line += segment.Text
+		}
+		if segment.Mandatory {
+			flush()
+		}
+	}
+	if line != "" {
+		flush()
+	}
+	return lines, broken
+}
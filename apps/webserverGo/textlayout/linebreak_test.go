@@ -0,0 +1,129 @@
+package textlayout
+
+import (
+	"image"
+	"slices"
+	"testing"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// fixedFace advances every rune by fixedAdvance pixels, except marks and
+// joiners, which take no room like in a real font. Widths in the tests below
+// are counts of characters.
+type fixedFace struct{}
+
+const fixedAdvance = 10
+
+func (fixedFace) advance(r rune) fixed.Int26_6 {
+	if unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Cf, r) {
+		return 0
+	}
+	return fixed.I(fixedAdvance)
+}
+
+func (fixedFace) Close() error { return nil }
+
+func (f fixedFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return image.Rectangle{}, nil, image.Point{}, f.advance(r), true
+}
+
+func (f fixedFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return fixed.Rectangle26_6{}, f.advance(r), true
+}
+
+func (f fixedFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.advance(r), true
+}
+
+func (fixedFace) Kern(r0, r1 rune) fixed.Int26_6 { return 0 }
+
+func (fixedFace) Metrics() font.Metrics {
+	return font.Metrics{Height: fixed.I(12), Ascent: fixed.I(10), Descent: fixed.I(2)}
+}
+
+func TestSegments(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Segment
+	}{
+		{"spaces", "hello big world", []Segment{{"hello ", false}, {"big ", false}, {"world", false}}},
+		{"hyphen", "well-known", []Segment{{"well-", false}, {"known", false}}},
+		{"punctuation stays with its word", "hi, there!", []Segment{{"hi, ", false}, {"there!", false}}},
+		{"brackets", "(hi) there", []Segment{{"(hi) ", false}, {"there", false}}},
+		{"chinese", "漢字漢字", []Segment{{"漢", false}, {"字", false}, {"漢", false}, {"字", false}}},
+		{"no line starts with a full stop", "日本語。テスト", []Segment{{"日", false}, {"本", false}, {"語。", false}, {"テ", false}, {"ス", false}, {"ト", false}}},
+		{"newline", "one\ntwo", []Segment{{"one\n", true}, {"two", false}}},
+		{"blank line", "one\n\ntwo", []Segment{{"one\n", true}, {"\n", true}, {"two", false}}},
+		{"trailing newline", "one\n", []Segment{{"one\n", false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Segments(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("Segments(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		width float64
+		want  []string
+	}{
+		{"fits", "hello world", 110, []string{"hello world"}},
+		{"breaks at spaces", "hello big world", 100, []string{"hello big", "world"}},
+		{"spaces hang past the end", "ab   cd", 20, []string{"ab", "cd"}},
+		{"hyphenated word", "well-known fact", 60, []string{"well-", "known", "fact"}},
+		{"chinese without spaces", "漢字漢字漢字", 40, []string{"漢字漢字", "漢字"}},
+		{"japanese keeps the full stop", "日本語。テスト", 30, []string{"日本", "語。テ", "スト"}},
+		{"overlong word", "abcdefghijkl", 50, []string{"abcd-", "efgh-", "ijkl"}},
+		{"overlong word after text", "hi abcdefghijkl", 50, []string{"hi", "abcd-", "efgh-", "ijkl"}},
+		{"overlong url", "see https://example.com/a/long/path", 80, []string{"see", "https://", "example.", "com/a/", "long/", "path"}},
+		{"no hyphen between symbols", "==========", 50, []string{"=====", "====="}},
+		{"combining marks stay on their letter", "e\u0301e\u0301e\u0301e\u0301", 25, []string{"e\u0301-", "e\u0301-", "e\u0301e\u0301"}},
+		{"zwj emoji stay whole", "👨‍👩‍👧👨‍👩‍👧", 15, []string{"👨‍👩‍👧", "👨‍👩‍👧"}},
+		{"flag stays whole", "🇯🇵🇯🇵", 15, []string{"🇯🇵", "🇯🇵"}},
+		{"newline", "one\ntwo", 100, []string{"one", "two"}},
+		{"blank line", "one\n\ntwo", 100, []string{"one", "", "two"}},
+		{"surrounding space", "  hi  ", 100, []string{"hi"}},
+		{"empty", " ", 100, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Wrap(fixedFace{}, tt.text, tt.width); !slices.Equal(got, tt.want) {
+				t.Errorf("Wrap(%q, %v) = %q, want %q", tt.text, tt.width, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreak(t *testing.T) {
+	tests := []struct {
+		name                 string
+		word                 string
+		firstWidth, maxWidth float64
+		hyphen               bool
+		want                 []string
+	}{
+		{"fits", "abc", 50, 50, true, []string{"abc"}},
+		{"without hyphens", "abcdefg", 30, 30, false, []string{"abc", "def", "g"}},
+		{"with hyphens", "abcdefg", 30, 30, true, []string{"ab-", "cd-", "efg"}},
+		{"short first line", "abcdefg", 20, 40, false, []string{"ab", "cdef", "g"}},
+		{"nothing fits the first line", "abcdef", 5, 30, false, []string{"", "abc", "def"}},
+		{"cluster wider than a line", "abc", 5, 5, false, []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Break(fixedFace{}, tt.word, tt.firstWidth, tt.maxWidth, tt.hyphen)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Break(%q, %v, %v, %v) = %q, want %q", tt.word, tt.firstWidth, tt.maxWidth, tt.hyphen, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package textlayout
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+
+	"jasper/fonts"
+	"jasper/utils"
+)
+
+// Style is how a line of text is painted. Sizes are fractions of the font
+// size, so a style looks the same at any size. Nil colors leave out their
+// part.
+type Style struct {
+	Fill color.Color
+	// Stroke outlines the glyphs along their paths, StrokeWidth wide. Half of
+	// the width shows outside the glyph.
+	Stroke      color.Color
+	StrokeWidth float64
+	// Shadow is a copy of the text, outline included, drawn below it and
+	// ShadowOffset down and to the right.
+	Shadow       color.Color
+	ShadowOffset float64
+	// Background fills a box behind each line, BackgroundPadding wider than
+	// the text on every side.
+	Background        color.Color
+	BackgroundPadding float64
+}
+
+// Impact is the white text with a black outline of classic memes.
+var Impact = Style{
+	Fill:        color.White,
+	Stroke:      color.Black,
+	StrokeWidth: 0.12,
+}
+
+const (
+	defaultShadowOffset      = 0.06
+	defaultBackgroundPadding = 0.15
+)
+
+// StyleOptions overrides parts of a Style. Colors are "#rrggbb" or
+// "#rrggbbaa", or "none" to leave the part out. Empty fields keep the style's
+// value.
+type StyleOptions struct {
+	Fill              string   `json:"fill"`
+	Stroke            string   `json:"stroke"`
+	StrokeWidth       *float64 `json:"strokeWidth"`
+	Shadow            string   `json:"shadow"`
+	ShadowOffset      *float64 `json:"shadowOffset"`
+	Background        string   `json:"background"`
+	BackgroundPadding *float64 `json:"backgroundPadding"`
+}
+
+// With returns the style with the options applied on top.
+func (s Style) With(o StyleOptions) (Style, error) {
+	colors := []struct {
+		name  string
+		value string
+		dst   *color.Color
+	}{
+		{"fill", o.Fill, &s.Fill},
+		{"stroke", o.Stroke, &s.Stroke},
+		{"shadow", o.Shadow, &s.Shadow},
+		{"background", o.Background, &s.Background},
+	}
+	for _, c := range colors {
+		switch c.value {
+		case "":
+			continue
+		case "none":
+			*c.dst = nil
+			continue
+		}
+		parsed, err := utils.ParseHexColor(c.value)
+		if err != nil {
+			return Style{}, fmt.Errorf("invalid %s color: %w", c.name, err)
+		}
+		*c.dst = parsed
+	}
+
+	sizes := []struct {
+		name  string
+		value *float64
+		dst   *float64
+	}{
+		{"strokeWidth", o.StrokeWidth, &s.StrokeWidth},
+		{"shadowOffset", o.ShadowOffset, &s.ShadowOffset},
+		{"backgroundPadding", o.BackgroundPadding, &s.BackgroundPadding},
+	}
+	for _, sz := range sizes {
+		if sz.value == nil {
+			continue
+		}
+		if *sz.value < 0 || *sz.value > 1 {
+			return Style{}, fmt.Errorf("%s must be between 0 and 1", sz.name)
+		}
+		*sz.dst = *sz.value
+	}
+
+	if s.Shadow != nil && s.ShadowOffset == 0 && o.ShadowOffset == nil {
+		s.ShadowOffset = defaultShadowOffset
+	}
+	if s.Background != nil && s.BackgroundPadding == 0 && o.BackgroundPadding == nil {
+		s.BackgroundPadding = defaultBackgroundPadding
+	}
+	return s, nil
+}
+
+// DrawString draws text with its baseline starting at (x, y), like
+// gg.Context.DrawString.
+func (s Style) DrawString(dc *gg.Context, face *fonts.MultiFace, text string, x, y float64) {
+	size := face.Size()
+	glyphs := lineGlyphs(face, text)
+
+	if s.Background != nil {
+		m := face.Metrics()
+		ascent, descent := float64(m.Ascent)/64, float64(m.Descent)/64
+		pad := s.BackgroundPadding * size
+		dc.SetColor(s.Background)
+		dc.DrawRectangle(x-pad, y-ascent-pad, Measure(face, text)+2*pad, ascent+descent+2*pad)
+		dc.Fill()
+	}
+	if s.Shadow != nil {
+		offset := s.ShadowOffset * size
+		s.paint(dc, face, glyphs, x+offset, y+offset, s.Shadow, s.Shadow)
+	}
+	s.paint(dc, face, glyphs, x, y, s.Fill, s.Stroke)
+}
+
+// DrawStringAnchored is gg.Context.DrawStringAnchored in a plain color, with
+// right-to-left text reordered and shaped the way DrawString does it.
+func DrawStringAnchored(dc *gg.Context, face font.Face, c color.Color, text string, x, y, ax, ay float64) {
+	dc.SetFontFace(face)
+	multi, ok := face.(*fonts.MultiFace)
+	if !ok || !hasRTL(text) {
+		dc.SetColor(c)
+		dc.DrawStringAnchored(text, x, y, ax, ay)
+		return
+	}
+	_, h := dc.MeasureString(text)
+	Style{Fill: c}.DrawString(dc, multi, text, x-ax*Measure(face, text), y+ay*h)
+}
+
+func (s Style) paint(dc *gg.Context, face *fonts.MultiFace, glyphs []fonts.Glyph, x, y float64, fill, stroke color.Color) {
+	if stroke != nil && s.StrokeWidth > 0 {
+		appendPath(dc, glyphs, x, y)
+		dc.SetColor(stroke)
+		dc.SetLineWidth(s.StrokeWidth * face.Size())
+		dc.SetLineJoin(gg.LineJoinRound)
+		dc.Stroke()
+	}
+	if fill == nil {
+		return
+	}
+	appendPath(dc, glyphs, x, y)
+	dc.SetColor(fill)
+	dc.Fill()
+
+	// Glyphs without outlines can only be drawn, not stroked.
+	dc.SetFontFace(face)
+	for _, g := range glyphs {
+		if g.Segments == nil {
+			dc.DrawString(string(g.Rune), x+g.X, y+g.Y)
+		}
+	}
+}
+
+// appendPath adds the outlines of glyphs set at (x, y) to the path of dc.
+func appendPath(dc *gg.Context, glyphs []fonts.Glyph, x, y float64) {
+	for _, g := range glyphs {
+		at := func(p fixed.Point26_6) (float64, float64) {
+			return x + g.X + float64(p.X)/64, y + g.Y + float64(p.Y)/64
+		}
+		for i, seg := range g.Segments {
+			switch seg.Op {
+			case sfnt.SegmentOpMoveTo:
+				if i > 0 {
+					dc.ClosePath()
+				}
+				dc.MoveTo(at(seg.Args[0]))
+			case sfnt.SegmentOpLineTo:
+				dc.LineTo(at(seg.Args[0]))
+			case sfnt.SegmentOpQuadTo:
+				x1, y1 := at(seg.Args[0])
+				x2, y2 := at(seg.Args[1])
+				dc.QuadraticTo(x1, y1, x2, y2)
+			case sfnt.SegmentOpCubeTo:
+				x1, y1 := at(seg.Args[0])
+				x2, y2 := at(seg.Args[1])
+				x3, y3 := at(seg.Args[2])
+				dc.CubicTo(x1, y1, x2, y2, x3, y3)
+			}
+		}
+		if len(g.Segments) > 0 {
+			dc.ClosePath()
+		}
+	}
+}
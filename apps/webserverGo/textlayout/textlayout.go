@@ -0,0 +1,79 @@
+// Package textlayout wraps and sizes text for the generators that set
+// captions and meme text.
+package textlayout
+
+import (
+	"log/slog"
+	"math"
+
+	"golang.org/x/image/font"
+
+	"jasper/fonts"
+)
+
+// AutoFontSize asks a generator to pick the font size with Fit instead of
+// using a fixed one.
+const AutoFontSize = 0
+
+// Measure returns the advance width of s in pixels. Text with right-to-left
+// characters is measured shaped, as it is drawn.
+func Measure(face font.Face, s string) float64 {
+	if multi, ok := face.(*fonts.MultiFace); ok && hasRTL(s) {
+		if width, ok := shapedWidth(multi, s); ok {
+			return width
+		}
+	}
+	return float64(font.MeasureString(face, s)) / 64
+}
+
+// Fitted is text wrapped at the size Fit chose.
+type Fitted struct {
+	Size  float64
+	Face  *fonts.MultiFace
+	Lines []string
+}
+
+// Fit finds the largest font size between minSize and maxSize at which text,
+// wrapped to width with lines lineHeight times the size apart, fits a
+// width×height box. Text that does not fit even at minSize is set at minSize.
+func Fit(family, text string, minSize, maxSize, lineHeight, width, height float64) (Fitted, error) {
+	layout := func(size float64) (Fitted, bool, error) {
+		face, err := fonts.Face(family, size)
+		if err != nil {
+			slog.Error("Failed to load font", "family", family, "error", err)
+			return Fitted{}, false, err
+		}
+		lines, broken := wrap(face, text, width)
+		fitted := Fitted{Size: size, Face: face, Lines: lines}
+		// Breaking a word only beats making the text smaller at minSize.
+		if broken || float64(len(lines))*size*lineHeight > height {
+			return fitted, false, nil
+		}
+		for _, line := range lines {
+			if Measure(face, line) > width {
+				return fitted, false, nil
+			}
+		}
+		return fitted, true, nil
+	}
+
+	// Faces are cached per size, so only whole pixel sizes are tried.
+	lo, hi := math.Ceil(minSize), math.Floor(max(maxSize, minSize))
+	if fitted, ok, err := layout(hi); err != nil || ok {
+		return fitted, err
+	}
+	for hi-lo > 1 {
+		mid := math.Floor((lo + hi) / 2)
+		_, ok, err := layout(mid)
+		if err != nil {
+			return Fitted{}, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	fitted, _, err := layout(lo)
+	return fitted, err
+}
@@ -0,0 +1,96 @@
+package textlayout
+
+import (
+	"strings"
+	"testing"
+
+	"jasper/fonts"
+)
+
+// fits reports whether text set at size in family fits a width×height box
+// without breaking a word, the way Fit decides it.
+func fits(t *testing.T, family, text string, size, lineHeight, width, height float64) bool {
+	t.Helper()
+	face, err := fonts.Face(family, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, broken := wrap(face, text, width)
+	if broken || float64(len(lines))*size*lineHeight > height {
+		return false
+	}
+	for _, line := range lines {
+		if Measure(face, line) > width {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name             string
+		text             string
+		minSize, maxSize float64
+		width, height    float64
+		want             float64
+		wantLines        int
+		// fit is whether the text fits the box at the size Fit picks.
+		fit bool
+	}{
+		{"short text is set at maxSize", "hi", 10, 40, 500, 500, 40, 1, true},
+		{"sizes are whole pixels inside the range", "hi", 10.5, 40.7, 500, 500, 40, 1, true},
+		{"maxSize below minSize is minSize", "hi", 20, 12, 500, 500, 20, 1, true},
+		{"text that does not fit is set at minSize", strings.Repeat("overflowing words ", 40), 12, 40, 100, 30, 12, 0, false},
+		{"a long word shrinks instead of breaking", "incomprehensibilities", 8, 60, 200, 200, 0, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const lineHeight = 1.2
+			fitted, err := Fit(fonts.Mono, tt.text, tt.minSize, tt.maxSize, lineHeight, tt.width, tt.height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != 0 && fitted.Size != tt.want {
+				t.Errorf("Size = %v, want %v", fitted.Size, tt.want)
+			}
+			if fitted.Face == nil || fitted.Face.Size() != fitted.Size {
+				t.Errorf("Face is not at the fitted size %v", fitted.Size)
+			}
+			if tt.wantLines != 0 && len(fitted.Lines) != tt.wantLines {
+				t.Errorf("Lines = %q, want %d", fitted.Lines, tt.wantLines)
+			}
+			if got := fits(t, fonts.Mono, tt.text, fitted.Size, lineHeight, tt.width, tt.height); got != tt.fit {
+				t.Errorf("text fits at %v = %v, want %v", fitted.Size, got, tt.fit)
+			}
+		})
+	}
+}
+
+func TestFitPicksTheLargestSizeThatFits(t *testing.T) {
+	const (
+		text       = "the quick brown fox jumps over the lazy dog"
+		lineHeight = 1.3
+		width      = 220
+		height     = 90
+	)
+	fitted, err := Fit(fonts.Mono, text, 8, 60, lineHeight, width, height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fitted.Size <= 8 || fitted.Size >= 60 {
+		t.Fatalf("Size = %v, want a size between the bounds for this box", fitted.Size)
+	}
+	if !fits(t, fonts.Mono, text, fitted.Size, lineHeight, width, height) {
+		t.Errorf("text does not fit at %v", fitted.Size)
+	}
+	if fits(t, fonts.Mono, text, fitted.Size+1, lineHeight, width, height) {
+		t.Errorf("text also fits at %v, larger than %v", fitted.Size+1, fitted.Size)
+	}
+}
+
+func TestFitUnknownFamily(t *testing.T) {
+	if _, err := Fit("no-such-family", "hi", 8, 40, 1.2, 100, 100); err == nil {
+		t.Error("Fit with an unknown family succeeded")
+	}
+}
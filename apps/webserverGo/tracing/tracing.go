@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName    = "jasper-webserver-go"
+	instrumentName = "jasper"
+)
+
+type config struct {
+	exporter sdktrace.SpanExporter
+	syncer   bool
+}
+
+type Option func(*config)
+
+// WithExporter replaces the exporter selected from the environment, e.g. with
+// tracetest.NewInMemoryExporter when asserting on spans.
+func WithExporter(exporter sdktrace.SpanExporter) Option {
+	return func(c *config) {
+		c.exporter = exporter
+	}
+}
+
+// WithSyncer exports every span as soon as it ends instead of batching.
+func WithSyncer() Option {
+	return func(c *config) {
+		c.syncer = true
+	}
+}
+
+// Init installs the global tracer provider and the W3C trace context propagator.
+// Spans are only exported when OTEL_TRACES_EXPORTER is set to "otlp", in which
+// case the standard OTEL_EXPORTER_OTLP_* variables configure the HTTP exporter.
+// The returned function flushes and shuts the provider down.
+func Init(ctx context.Context, opts ...Option) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	cfg := config{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.exporter == nil {
+		switch strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER")) {
+		case "otlp":
+			exporter, err := otlptracehttp.New(ctx)
+			if err != nil {
+				return nil, err
+			}
+			cfg.exporter = exporter
+		default:
+			return func(context.Context) error { return nil }, nil
+		}
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	processor := sdktrace.NewBatchSpanProcessor(cfg.exporter)
+	if cfg.syncer {
+		processor = sdktrace.NewSimpleSpanProcessor(cfg.exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentName)
+}
+
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// RecordError marks the span as failed and returns err unchanged so it can be
+// used inline in return statements.
+func RecordError(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
@@ -1,35 +1,54 @@
 package utils
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"image"
-	_ "image/gif"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
 	_ "image/jpeg"
-	_ "image/png"
+	"image/png"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"path"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/image/draw"
-	"golang.org/x/image/font"
-	"golang.org/x/image/font/opentype"
 	_ "golang.org/x/image/webp"
+
+	"jasper/tracing"
 )
 
+// MaxImagePixels is the largest image LoadImageFromURL decodes, about 200 MB
+// as RGBA.
+const MaxImagePixels = 50_000_000
+
 var allowedImageTypes = map[string]struct{}{
 	"image/jpeg": {},
 	"image/webp": {},
+	"image/png":  {},
+	"image/gif":  {},
 	".jpg":       {},
 	".jpeg":      {},
 	".webp":      {},
+	".png":       {},
+	".gif":       {},
 }
 
-func IsSupportedImageURL(rawURL string) (bool, string, error) {
+func IsSupportedImageURL(ctx context.Context, rawURL string) (ok bool, mime string, err error) {
+	ctx, span := tracing.Start(ctx, "utils.IsSupportedImageURL", attribute.String("url", rawURL))
+	defer func() {
+		span.SetAttributes(attribute.String("image.mime", mime), attribute.Bool("image.supported", ok))
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
 	parsed, err := url.Parse(rawURL)
 	if err != nil {
 		return false, "", fmt.Errorf("invalid URL: %w", err)
@@ -40,7 +59,7 @@ func IsSupportedImageURL(rawURL string) (bool, string, error) {
 
 	client := &http.Client{Timeout: 10 * time.Second}
 
-	req, err := http.NewRequest(http.MethodHead, parsed.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, parsed.String(), nil)
 	if err != nil {
 		return false, "", err
 	}
@@ -59,7 +78,7 @@ func IsSupportedImageURL(rawURL string) (bool, string, error) {
 		}
 	}
 
-	getReq, err := http.NewRequest(http.MethodGet, parsed.String(), nil)
+	getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
 	if err != nil {
 		return false, "", err
 	}
@@ -102,7 +121,13 @@ func IsSupportedImageURL(rawURL string) (bool, string, error) {
 	return false, sniffed, fmt.Errorf("URL does not appear to be an allowed image (sniffed: %s)", sniffed)
 }
 
-func LoadImageFromURL(rawURL string) (image.Image, error) {
+func LoadImageFromURL(ctx context.Context, rawURL string) (img image.Image, err error) {
+	ctx, span := tracing.Start(ctx, "utils.LoadImageFromURL", attribute.String("url", rawURL))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
 	parsed, err := url.Parse(rawURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid URL: %w", err)
@@ -111,7 +136,7 @@ func LoadImageFromURL(rawURL string) (image.Image, error) {
 		return nil, fmt.Errorf("unsupported URL scheme: %s", parsed.Scheme)
 	}
 
-	ok, mime, err := IsSupportedImageURL(rawURL)
+	ok, mime, err := IsSupportedImageURL(ctx, rawURL)
 	if err != nil {
 		return nil, err
 	}
@@ -124,7 +149,11 @@ func LoadImageFromURL(rawURL string) (image.Image, error) {
 
 	client := &http.Client{Timeout: 15 * time.Second}
 
-	resp, err := client.Get(parsed.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch image: %w", err)
 	}
@@ -135,22 +164,97 @@ func LoadImageFromURL(rawURL string) (image.Image, error) {
 	}
 
 	const maxBytes = 25 * 1024 * 1024
-	limitedReader := io.LimitReader(resp.Body, maxBytes)
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch image: %w", err)
+	}
 
-	img, _, err := image.Decode(limitedReader)
+	// The header gives the size before anything is decoded, so small files
+	// of huge images are turned away before they take gigabytes.
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
+	if config.Width*config.Height > MaxImagePixels {
+		return nil, fmt.Errorf("image is %dx%d, larger than the %d pixel limit", config.Width, config.Height, MaxImagePixels)
+	}
+
+	_, decodeSpan := tracing.Start(ctx, "image.Decode")
+	img, format, err := image.Decode(bytes.NewReader(data))
+	decodeSpan.SetAttributes(attribute.String("image.format", format))
+	tracing.RecordError(decodeSpan, err)
+	decodeSpan.End()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	span.SetAttributes(attribute.Int("image.width", img.Bounds().Dx()), attribute.Int("image.height", img.Bounds().Dy()))
 
 	return img, nil
 }
 
+func EncodePNG(ctx context.Context, w io.Writer, img image.Image) error {
+	_, span := tracing.Start(ctx, "png.Encode")
+	defer span.End()
+	if err := ctx.Err(); err != nil {
+		return tracing.RecordError(span, err)
+	}
+	return tracing.RecordError(span, png.Encode(w, img))
+}
+
+// gifPalette is the web-safe colors, a ramp of grays between its six and a
+// transparent entry, which the GIF encoder marks as the transparent index.
+var gifPalette = func() color.Palette {
+	p := append(color.Palette{color.Transparent}, palette.WebSafe...)
+	for i := 1; i < 45 && len(p) < 256; i++ {
+		v := uint8(i * 255 / 45)
+		if v%0x33 != 0 {
+			p = append(p, color.Gray{Y: v})
+		}
+	}
+	return p
+}()
+
+// EncodeGIF writes frames as a GIF that loops forever, showing each frame for
+// delay hundredths of a second. Colors are dithered to a fixed palette, and
+// transparent pixels stay transparent.
+func EncodeGIF(ctx context.Context, w io.Writer, frames []image.Image, delay int) error {
+	_, span := tracing.Start(ctx, "gif.Encode", attribute.Int("gif.frames", len(frames)))
+	defer span.End()
+
+	anim := &gif.GIF{}
+	for _, frame := range frames {
+		if err := ctx.Err(); err != nil {
+			return tracing.RecordError(span, err)
+		}
+		b := frame.Bounds()
+		paletted := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), gifPalette)
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), frame, b.Min)
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, delay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalBackground)
+	}
+	return tracing.RecordError(span, gif.EncodeAll(w, anim))
+}
+
 func ResizeImage(img image.Image, width, height int) image.Image {
 	dst := image.NewRGBA(image.Rect(0, 0, width, height))
 	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Over, nil)
 	return dst
 }
 
+// ResizeImageToFill scales img to cover width×height and crops the overflow
+// evenly from both sides, like CSS object-fit: cover.
+func ResizeImageToFill(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	scale := max(float64(width)/float64(b.Dx()), float64(height)/float64(b.Dy()))
+	cw, ch := int(float64(width)/scale), int(float64(height)/scale)
+	x0, y0 := b.Min.X+(b.Dx()-cw)/2, b.Min.Y+(b.Dy()-ch)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, image.Rect(x0, y0, x0+cw, y0+ch), draw.Over, nil)
+	return dst
+}
+
 func ConvertHexColor(hex string) (float64, float64, float64) {
 	if len(hex) != 7 || hex[0] != '#' {
 		return 1, 1, 1
@@ -163,18 +267,17 @@ func ConvertHexColor(hex string) (float64, float64, float64) {
 	return float64(r) / 255.0, float64(g) / 255.0, float64(b) / 255.0
 }
 
-func LoadFont(path string, size float64) (font.Face, error) {
-	fontBytes, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	f, err := opentype.Parse(fontBytes)
-	if err != nil {
-		return nil, err
+// ParseHexColor parses a "#rrggbb" or "#rrggbbaa" color.
+func ParseHexColor(hex string) (color.NRGBA, error) {
+	c := color.NRGBA{A: 255}
+	var err error
+	switch len(hex) {
+	case 7:
+		_, err = fmt.Sscanf(hex, "#%02x%02x%02x", &c.R, &c.G, &c.B)
+	case 9:
+		_, err = fmt.Sscanf(hex, "#%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A)
+	default:
+		err = fmt.Errorf("%q is not #rrggbb or #rrggbbaa", hex)
 	}
-	return opentype.NewFace(f, &opentype.FaceOptions{
-		Size:    size,
-		DPI:     72,
-		Hinting: font.HintingFull,
-	})
+	return c, err
 }
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// pngHeader is the start of a PNG claiming to be width×height, enough for
+// image.DecodeConfig but not for image.Decode.
+func pngHeader(width, height uint32) []byte {
+	var ihdr bytes.Buffer
+	ihdr.WriteString("IHDR")
+	binary.Write(&ihdr, binary.BigEndian, width)
+	binary.Write(&ihdr, binary.BigEndian, height)
+	// 8-bit RGBA, deflate, no filter method or interlacing.
+	ihdr.Write([]byte{8, 6, 0, 0, 0})
+
+	var b bytes.Buffer
+	b.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&b, binary.BigEndian, uint32(ihdr.Len()-4))
+	b.Write(ihdr.Bytes())
+	binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(ihdr.Bytes()))
+	return b.Bytes()
+}
+
+func TestLoadImageFromURLLimitsPixels(t *testing.T) {
+	var small bytes.Buffer
+	if err := png.Encode(&small, image.NewRGBA(image.Rect(0, 0, 30, 20))); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		if r.URL.Path == "/huge.png" {
+			w.Write(pngHeader(20_000, 20_000))
+			return
+		}
+		w.Write(small.Bytes())
+	}))
+	defer server.Close()
+
+	img, err := LoadImageFromURL(context.Background(), server.URL+"/small.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 30 || b.Dy() != 20 {
+		t.Errorf("loaded a %v image, want 30x20", b)
+	}
+
+	_, err = LoadImageFromURL(context.Background(), server.URL+"/huge.png")
+	if err == nil || !strings.Contains(err.Error(), "pixel limit") {
+		t.Errorf("loading a 20000x20000 image = %v, want the pixel limit error", err)
+	}
+}
@@ -1,15 +1,20 @@
 package utils
 
 import (
+	"context"
 	"math/rand"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"jasper/tracing"
 )
 
-func getApiKey() string {
+func youtubeApiKeys() []string {
     apiKey1 := os.Getenv("YOUTUBE_API_KEY_1")
     apiKey2 := os.Getenv("YOUTUBE_API_KEY_2")
     apiKey3 := os.Getenv("YOUTUBE_API_KEY_3")
@@ -21,7 +26,15 @@ func getApiKey() string {
 			filtered = append(filtered, str)
 		}
 	}
+    return filtered
+}
 
+func HasYoutubeApiKey() bool {
+    return len(youtubeApiKeys()) > 0
+}
+
+func getApiKey() string {
+    filtered := youtubeApiKeys()
     if len(filtered) == 0 {
         panic("No valid YouTube API keys found in environment variables")
     }
@@ -30,12 +43,43 @@ func getApiKey() string {
     return filtered[randomIndex]
 }
 
-func FetchChannelData(channelID string) (map[string]interface{}, error) {
+func youtubeGet(ctx context.Context, endpoint string, url string) (map[string]any, error) {
+    ctx, span := tracing.Start(ctx, "youtube."+endpoint)
+    defer span.End()
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+    if err != nil {
+        return nil, tracing.RecordError(span, err)
+    }
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return nil, tracing.RecordError(span, err)
+    }
+    defer resp.Body.Close()
+    span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+    var result map[string]any
+    err = json.NewDecoder(resp.Body).Decode(&result)
+    if err != nil {
+        return nil, tracing.RecordError(span, err)
+    }
+    return result, nil
+}
+
+func FetchChannelData(ctx context.Context, channelID string) (data map[string]interface{}, err error) {
+    ctx, span := tracing.Start(ctx, "youtube.FetchChannelData", attribute.String("youtube.channel_id", channelID))
+    defer func() {
+        tracing.RecordError(span, err)
+        span.End()
+    }()
+
     CacheLock.RLock()
     cached, found := Cache[channelID]
     CacheLock.RUnlock()
 
-    if found && time.Since(cached.timestamp) < CacheTTL {
+    fresh := found && time.Since(cached.timestamp) < CacheTTL
+    span.SetAttributes(attribute.Bool("cache.hit", fresh))
+    if fresh {
         return cached.data, nil
     }
 
@@ -44,14 +88,7 @@ func FetchChannelData(channelID string) (map[string]interface{}, error) {
         "https://www.googleapis.com/youtube/v3/channels?part=statistics&fields=kind,etag,pageInfo,items(id,statistics)&id=%s&key=%s",
         channelID, getApiKey())
 
-    statsResp, err := http.Get(statsURL)
-    if err != nil {
-        return nil, err
-    }
-    defer statsResp.Body.Close()
-
-    var statsResult map[string]any
-    err = json.NewDecoder(statsResp.Body).Decode(&statsResult)
+    statsResult, err := youtubeGet(ctx, "channels", statsURL)
     if err != nil {
         return nil, err
     }
@@ -61,14 +98,7 @@ func FetchChannelData(channelID string) (map[string]interface{}, error) {
         "https://www.googleapis.com/youtube/v3/search?key=%s&channelId=%s&part=snippet,id&order=date&maxResults=1",
         getApiKey(), channelID)
 
-    videoResp, err := http.Get(videoURL)
-    if err != nil {
-        return nil, err
-    }
-    defer videoResp.Body.Close()
-
-    var videoResult map[string]any
-    err = json.NewDecoder(videoResp.Body).Decode(&videoResult)
+    videoResult, err := youtubeGet(ctx, "search", videoURL)
     if err != nil {
         return nil, err
     }
@@ -0,0 +1,54 @@
+// Package warnings collects the non-fatal problems of a request, such as an
+// avatar that failed to load and was replaced, so they can be reported to the
+// caller alongside an otherwise successful response.
+package warnings
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey struct{}
+
+// Collector gathers warnings. It is safe for concurrent use.
+type Collector struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+// NewContext returns a context that Add records warnings into.
+func NewContext(ctx context.Context) (context.Context, *Collector) {
+	c := &Collector{}
+	return context.WithValue(ctx, contextKey{}, c), c
+}
+
+// Add records a warning on the context's collector and as an event on the
+// current span. It does nothing for contexts without a collector, so
+// generators can warn regardless of how they are called.
+func Add(ctx context.Context, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	trace.SpanFromContext(ctx).AddEvent("warning", trace.WithAttributes(attribute.String("message", msg)))
+
+	c, ok := ctx.Value(contextKey{}).(*Collector)
+	if !ok {
+		return
+	}
+	// Warnings end up in response headers, which cannot span lines.
+	msg = strings.NewReplacer("\r", " ", "\n", " ").Replace(msg)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warnings = append(c.warnings, msg)
+}
+
+// Warnings returns the warnings recorded so far.
+func (c *Collector) Warnings() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.warnings...)
+}